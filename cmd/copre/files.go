@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jsnanigans/copre/pkg/copre"
+)
+
+// globList is a flag that can be repeated to give several glob patterns.
+type globList []string
+
+func (g *globList) String() string { return strings.Join(*g, ",") }
+
+func (g *globList) Set(pattern string) error {
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return err
+	}
+	*g = append(*g, pattern)
+	return nil
+}
+
+// matchAny reports whether name, a slash-separated path, matches any of the patterns.
+func (g globList) matchAny(name string) bool {
+	for _, pattern := range g {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob reports whether name, a slash-separated path, matches pattern. A pattern
+// without a slash matches the last element of name, as in .gitignore; "**" matches any
+// number of path elements.
+func matchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchElems(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(name, "/"))
+}
+
+// matchElems matches the elements of a path against those of a pattern.
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := range len(name) + 1 {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ignoreRule is a pattern of a .gitignore file.
+type ignoreRule struct {
+	base    string // The directory of the .gitignore file, relative to the walked root
+	pattern string
+	negate  bool // A "!" pattern, re-including what earlier rules ignore
+	dirOnly bool // A pattern ending in "/", matching directories only
+}
+
+// readIgnoreRules reads the rules of the .gitignore file in dir, if there is one.
+func readIgnoreRules(dir, base string) []ignoreRule {
+	data, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		if rule.negate = strings.HasPrefix(line, "!"); rule.negate {
+			line = line[1:]
+		}
+		if rule.dirOnly = strings.HasSuffix(line, "/"); rule.dirOnly {
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.HasPrefix(line, "/") && !strings.Contains(line[1:], "/") {
+			line = line[1:] + "/" // Anchored to base; matchGlob treats it as a path
+		}
+		rule.pattern = strings.TrimPrefix(line, `\`)
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ignored reports whether the rules ignore name, a slash-separated path relative to the
+// walked root. As in git, the last matching rule decides.
+func ignored(rules []ignoreRule, name string, isDir bool) bool {
+	result := false
+	for _, rule := range rules {
+		rel := name
+		if rule.base != "." {
+			var ok bool
+			if rel, ok = strings.CutPrefix(name, rule.base+"/"); !ok {
+				continue
+			}
+		}
+		if (!rule.dirOnly || isDir) && matchGlob(rule.pattern, rel) {
+			result = !rule.negate
+		}
+	}
+	return result
+}
+
+// collectFiles returns the text files in the tree at root that match one of include
+// (every file if there are none) and none of exclude, skipping the files and directories
+// that .gitignore files in the tree ignore, the .git directory and binary files. Paths
+// are joined to root and patterns match paths relative to root.
+func collectFiles(root string, include, exclude globList) ([]copre.File, error) {
+	files := []copre.File{}
+	rules := map[string][]ignoreRule{} // Directory -> the rules that apply in it
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if d.IsDir() {
+			if name != "." && (d.Name() == ".git" || ignored(rules[path.Dir(name)], name, true) || exclude.matchAny(name)) {
+				return filepath.SkipDir
+			}
+			inherited := rules[path.Dir(name)]
+			rules[name] = append(inherited[:len(inherited):len(inherited)], readIgnoreRules(p, name)...)
+			return nil
+		}
+		if !d.Type().IsRegular() || ignored(rules[path.Dir(name)], name, false) || exclude.matchAny(name) ||
+			len(include) > 0 && !include.matchAny(name) {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(data, 0) >= 0 {
+			return nil // Binary files have no lines to predict edits on
+		}
+		files = append(files, copre.File{Path: p, Text: string(data)})
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{pattern: "*.go", name: "a.go", want: true},
+		{pattern: "*.go", name: "pkg/sub/a.go", want: true},
+		{pattern: "*.go", name: "a.go.txt", want: false},
+		{pattern: "pkg/*.go", name: "pkg/a.go", want: true},
+		{pattern: "pkg/*.go", name: "pkg/sub/a.go", want: false},
+		{pattern: "pkg/**/*.go", name: "pkg/a.go", want: true},
+		{pattern: "pkg/**/*.go", name: "pkg/sub/deep/a.go", want: true},
+		{pattern: "**/testdata", name: "a/b/testdata", want: true},
+		{pattern: "/build", name: "build", want: true},
+		{pattern: "/build", name: "sub/build", want: false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCollectFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		".gitignore":        "*.log\n/build/\nvendor\n!keep.log\n",
+		".git/config":       "[core]\n",
+		"a.go":              "package a\n",
+		"a.log":             "ignored\n",
+		"keep.log":          "re-included\n",
+		"build/out.go":      "ignored\n",
+		"sub/build/out.go":  "not anchored here\n",
+		"sub/.gitignore":    "*.txt\n",
+		"sub/b.txt":         "ignored in sub\n",
+		"c.txt":             "only ignored in sub\n",
+		"vendor/v.go":       "ignored\n",
+		"sub/testdata/t.go": "excluded\n",
+		"sub/image.png":     "\x89PNG\x00",
+	})
+
+	tests := []struct {
+		name             string
+		include, exclude globList
+		want             []string
+	}{
+		{
+			name: "all",
+			want: []string{".gitignore", "a.go", "c.txt", "keep.log", "sub/.gitignore", "sub/build/out.go", "sub/testdata/t.go"},
+		},
+		{
+			name:    "include and exclude",
+			include: globList{"*.go"},
+			exclude: globList{"testdata"},
+			want:    []string{"a.go", "sub/build/out.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := collectFiles(dir, tt.include, tt.exclude)
+			if err != nil {
+				t.Fatalf("collectFiles() error = %v", err)
+			}
+			var got []string
+			for _, f := range files {
+				rel, _ := filepath.Rel(dir, f.Path)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("collectFiles() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
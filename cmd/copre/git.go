@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/jsnanigans/copre/pkg/copre"
+)
+
+// gitCommand runs copre git with the given arguments in the directory dir: it predicts
+// the next changes to each modified file of the repository from its committed (or
+// staged) version to the working copy.
+func gitCommand(args []string, dir string, stdout, stderr io.Writer) error {
+	flags := newFlagSet("git", "copre git [flags] [PATH...]", stderr)
+	optFlags := addOptionFlags(flags)
+	staged := flags.Bool("staged", false, "predict from the staged version of each file instead of HEAD, so only unstaged edits count")
+	out := addOutputFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if err := out.check(flags); err != nil {
+		return err
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	toplevel, err := gitOutput(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	top := strings.TrimSpace(string(toplevel))
+	rev := "HEAD"
+	if *staged {
+		rev = "" // The index
+	}
+	names, err := modifiedFiles(dir, rev, flags.Args())
+	if err != nil {
+		return err
+	}
+
+	opts := optFlags.options(stderr)
+	files := []filePredictions{}
+	for _, name := range names {
+		oldText, err := gitOutput(dir, "cat-file", "blob", rev+":"+name)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(top, filepath.FromSlash(name))
+		newText, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if bytes.IndexByte(oldText, 0) >= 0 || bytes.IndexByte(newText, 0) >= 0 {
+			continue // Binary files have no lines to predict edits on
+		}
+		if rel, err := filepath.Rel(dir, path); err == nil {
+			path = rel
+		}
+
+		predictions, err := copre.PredictWithOptions(context.Background(), string(oldText), string(newText), opts)
+		if err != nil && !errors.Is(err, copre.ErrTruncated) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v; the predictions are partial\n", path, err)
+		}
+		if len(predictions) > 0 {
+			files = append(files, filePredictions{
+				Path:          path,
+				predictResult: predictResult{Predictions: predictions, Truncated: err != nil},
+				text:          string(newText),
+			})
+		}
+	}
+	return writeFilePredictions(stdout, *out, files)
+}
+
+// modifiedFiles returns the paths, relative to the top of the repository, of the files
+// matching the pathspecs whose working copy differs from their version at rev ("" for
+// the index). Added, deleted and renamed files are left out: they have no two versions
+// of the same file to predict from.
+func modifiedFiles(dir, rev string, pathspecs []string) ([]string, error) {
+	args := []string{"diff", "--name-only", "-z", "--no-renames", "--diff-filter=M"}
+	if rev != "" {
+		args = append(args, rev)
+	}
+	args = append(args, "--")
+	out, err := gitOutput(dir, append(args, pathspecs...)...)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// gitOutput runs git with the given arguments in dir and returns its output. A failure
+// is reported with git's own error message.
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return nil, fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return out, err
+}
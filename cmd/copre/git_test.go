@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// gitRepo creates a repository in a temporary directory with the given files committed.
+func gitRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		if _, err := gitOutput(dir, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGitCommand(t *testing.T) {
+	dir := gitRepo(t, map[string]string{
+		"a.go":        "x := userId\ny := userId\n",
+		"sub/b.go":    "p.old()\nq.old()\nr.old()\n",
+		"same.go":     "unchanged\n",
+		"deleted.go":  "gone.old()\n",
+		"binary.data": "\x00.old\n\x00.old\n",
+	})
+	writeFiles(t, dir, map[string]string{
+		"a.go":        "x := accountId\ny := userId\n",
+		"sub/b.go":    "p()\nq.old()\nr.old()\n",
+		"new.go":      "untracked.old()\n",
+		"binary.data": "\x00\n\x00.old\n",
+	})
+	os.Remove(filepath.Join(dir, "deleted.go"))
+
+	tests := []struct {
+		name string
+		dir  string
+		args []string
+		want string
+	}{
+		{
+			name: "all files",
+			dir:  dir,
+			want: "a.go:2:6: replace \"userId\" with \"accountId\" (score 9)\n" +
+				"sub/b.go:2:2: remove \".old\" (score 7)\n" +
+				"sub/b.go:3:2: remove \".old\" (score 7)\n",
+		},
+		{
+			name: "paths relative to a subdirectory",
+			dir:  filepath.Join(dir, "sub"),
+			args: []string{"--max-results", "1", "."},
+			want: "b.go:2:2: remove \".old\" (score 7)\n",
+		},
+		{
+			name: "staged edits are the baseline",
+			dir:  dir,
+			args: []string{"--staged", "sub"},
+			want: "",
+		},
+	}
+
+	// Stage the edit of sub/b.go, leaving nothing unstaged there
+	if _, err := gitOutput(dir, "add", "sub/b.go"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if err := gitCommand(tt.args, tt.dir, &stdout, &stderr); err != nil {
+				t.Fatalf("gitCommand() error = %v (stderr %q)", err, stderr.String())
+			}
+			if stdout.String() != tt.want {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestGitCommandJSON(t *testing.T) {
+	dir := gitRepo(t, map[string]string{"a.txt": "a.old\nb.old\n"})
+	writeFiles(t, dir, map[string]string{"a.txt": "a\nb.old\n"})
+
+	var stdout, stderr bytes.Buffer
+	if err := gitCommand([]string{"--format=json"}, dir, &stdout, &stderr); err != nil {
+		t.Fatalf("gitCommand() error = %v (stderr %q)", err, stderr.String())
+	}
+	var got struct {
+		Files []struct {
+			Path        string
+			Predictions []struct{ MappedPosition int }
+		}
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshalling %s: %v", stdout.Bytes(), err)
+	}
+	if len(got.Files) != 1 || got.Files[0].Path != "a.txt" || len(got.Files[0].Predictions) != 1 || got.Files[0].Predictions[0].MappedPosition != 3 {
+		t.Errorf("copre git --format=json = %s", stdout.Bytes())
+	}
+}
+
+func TestGitCommandOutsideRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not found")
+	}
+	var stdout, stderr bytes.Buffer
+	if err := gitCommand(nil, t.TempDir(), &stdout, &stderr); err == nil {
+		t.Errorf("gitCommand() error = nil, want an error outside a repository")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// httpMethods are the server methods copre serve --http exposes, each at POST /<method>.
+var httpMethods = []string{"predict", "apply", "explain", "visualize", "close"}
+
+// runServeHTTP serves the server methods over HTTP on addr until the server fails. At
+// most maxDocs documents are open.
+func runServeHTTP(addr string, stdout io.Writer, maxDocs int) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Listening on http://%s\n", listener.Addr())
+	server := &http.Server{
+		Handler:           newHTTPHandler(newServer(maxDocs)),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+	return server.Serve(listener)
+}
+
+// newHTTPHandler returns the handler of copre serve --http: a POST endpoint per server
+// method, taking the method's params as the JSON body and answering with its result,
+// and GET /health.
+func newHTTPHandler(s *server) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	for _, method := range httpMethods {
+		mux.HandleFunc("POST /"+method, func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+			var tooLarge *http.MaxBytesError
+			switch {
+			case errors.As(err, &tooLarge):
+				writeJSON(w, http.StatusRequestEntityTooLarge, map[string]any{"error": &rpcError{codeInvalidRequest, fmt.Sprintf("request exceeds %d bytes", tooLarge.Limit)}})
+				return
+			case err != nil:
+				writeJSON(w, http.StatusBadRequest, map[string]any{"error": &rpcError{codeInvalidRequest, err.Error()}})
+				return
+			}
+			result, rpcErr := s.call(r.Context(), method, body)
+			if rpcErr != nil {
+				writeJSON(w, httpStatus(rpcErr), map[string]any{"error": rpcErr})
+				return
+			}
+			writeJSON(w, http.StatusOK, result)
+		})
+	}
+	return mux
+}
+
+// httpStatus returns the HTTP status of a failed request.
+func httpStatus(rpcErr *rpcError) int {
+	switch rpcErr.Code {
+	case codeRequestFailed:
+		return http.StatusInternalServerError
+	case codeMethodNotFound:
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// writeJSON writes v as the JSON body of a response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestServeHTTP(t *testing.T) {
+	ts := httptest.NewServer(newHTTPHandler(newServer(defaultMaxDocuments)))
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		want       string // The expected JSON body, if any
+	}{
+		{
+			name:       "health",
+			method:     http.MethodGet,
+			path:       "/health",
+			wantStatus: http.StatusOK,
+			want:       `{"status": "ok"}`,
+		},
+		{
+			name:       "predict",
+			method:     http.MethodPost,
+			path:       "/predict",
+			body:       `{"oldText": "first.old()\nsecond.old()", "newText": "first()\nsecond.old()"}`,
+			wantStatus: http.StatusOK,
+			want:       `{"predictions": [{"position": 18, "textToRemove": ".old", "textToAdd": "", "line": 2, "score": 7, "mappedPosition": 14}]}`,
+		},
+		{
+			name:       "apply",
+			method:     http.MethodPost,
+			path:       "/apply",
+			body:       `{"text": "first()\nsecond.old()", "predictions": [{"textToRemove": ".old", "mappedPosition": 14}]}`,
+			wantStatus: http.StatusOK,
+			want:       `{"text": "first()\nsecond()", "applied": [{"position": 0, "textToRemove": ".old", "textToAdd": "", "line": 0, "score": 0, "mappedPosition": 14}], "skipped": []}`,
+		},
+		{
+			name:       "visualize",
+			method:     http.MethodPost,
+			path:       "/visualize",
+			body:       `{"text": "a.old", "predictions": [{"textToRemove": ".old", "mappedPosition": 1}]}`,
+			wantStatus: http.StatusOK,
+			want:       `{"text": "a\u001b[31m.old\u001b[0m"}`,
+		},
+		{
+			name:       "invalid params",
+			method:     http.MethodPost,
+			path:       "/predict",
+			body:       `{"oldTxt": "a"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing body",
+			method:     http.MethodPost,
+			path:       "/apply",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too large",
+			method:     http.MethodPost,
+			path:       "/predict",
+			body:       `{"oldText": "` + strings.Repeat("x", maxRequestSize) + `"}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "wrong HTTP method",
+			method:     http.MethodGet,
+			path:       "/predict",
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:       "unknown path",
+			method:     http.MethodPost,
+			path:       "/unknown",
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusRequestEntityTooLarge {
+				// Failures the handler reports carry an error object
+				var body struct{ Error *rpcError }
+				if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == nil || body.Error.Message == "" {
+					t.Errorf("error body = %+v, %v, want an error object", body, err)
+				}
+				return
+			}
+			if tt.want == "" {
+				return
+			}
+			var got, want any
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			json.Unmarshal([]byte(tt.want), &want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("body = %v, want %v", got, want)
+			}
+		})
+	}
+}
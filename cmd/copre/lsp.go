@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+
+	"github.com/jsnanigans/copre/pkg/copre"
+)
+
+// LSP types, reduced to the fields copre uses.
+type (
+	lspPosition struct {
+		Line      int `json:"line"`
+		Character int `json:"character"`
+	}
+	lspRange struct {
+		Start lspPosition `json:"start"`
+		End   lspPosition `json:"end"`
+	}
+	lspTextEdit struct {
+		Range   lspRange `json:"range"`
+		NewText string   `json:"newText"`
+	}
+	lspDiagnostic struct {
+		Range    lspRange `json:"range"`
+		Severity int      `json:"severity"`
+		Source   string   `json:"source"`
+		Message  string   `json:"message"`
+	}
+	lspCodeAction struct {
+		Title       string           `json:"title"`
+		Kind        string           `json:"kind"`
+		Diagnostics []lspDiagnostic  `json:"diagnostics,omitempty"`
+		IsPreferred bool             `json:"isPreferred,omitempty"`
+		Edit        lspWorkspaceEdit `json:"edit"`
+	}
+	lspWorkspaceEdit struct {
+		Changes map[string][]lspTextEdit `json:"changes"`
+	}
+	lspDocumentParams struct {
+		TextDocument struct {
+			URI     string `json:"uri"`
+			Version int    `json:"version"`
+			Text    string `json:"text"`
+		} `json:"textDocument"`
+		ContentChanges []struct {
+			Range *lspRange `json:"range"`
+			Text  string    `json:"text"`
+		} `json:"contentChanges"`
+	}
+	lspCodeActionParams struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+		Range lspRange `json:"range"`
+	}
+)
+
+// severityHint is the LSP DiagnosticSeverity of predictions.
+const severityHint = 4
+
+// lspDocument is an open document and the session predicting its next changes.
+type lspDocument struct {
+	version     int
+	text        string
+	session     *copre.Session
+	predictions []copre.PredictedChange
+}
+
+// lspServer is a language server that reports predictions as hint diagnostics and
+// offers code actions applying them. It serves one client, handling one message at a
+// time.
+type lspServer struct {
+	in       *textproto.Reader
+	out      *bufio.Writer
+	docs     map[string]*lspDocument
+	shutdown bool // Whether the client has requested shutdown
+}
+
+// runLSP serves the Language Server Protocol on in and out until the client exits.
+func runLSP(in io.Reader, out io.Writer) error {
+	s := &lspServer{
+		in:   textproto.NewReader(bufio.NewReader(in)),
+		out:  bufio.NewWriter(out),
+		docs: make(map[string]*lspDocument),
+	}
+	for {
+		body, err := s.read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.reply(nil, nil, &rpcError{codeParseError, err.Error()})
+		} else if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit without shutdown")
+			}
+			return nil
+		} else if result, rpcErr := s.handle(msg); msg.ID != nil {
+			s.reply(msg.ID, result, rpcErr)
+		} else if rpcErr != nil {
+			// Notifications get no response, so tell the user instead
+			s.notify("window/logMessage", map[string]any{"type": 1, "message": "copre: " + rpcErr.Message})
+		}
+		if err := s.out.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// read reads the content of the next message.
+func (s *lspServer) read() ([]byte, error) {
+	header, err := s.in.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length: %w", err)
+	}
+	if length < 0 || length > maxRequestSize {
+		return nil, fmt.Errorf("invalid Content-Length %d: want 0 to %d bytes", length, maxRequestSize)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.in.R, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// write queues a message to the client. Messages are sent when the output is flushed
+// after each incoming message, which also reports write errors.
+func (s *lspServer) write(msg map[string]any) {
+	msg["jsonrpc"] = "2.0"
+	body, _ := json.Marshal(msg) // Messages are built from plain values and always marshal
+	fmt.Fprintf(s.out, "Content-Length: %d\r\n\r\n", len(body))
+	s.out.Write(body)
+}
+
+// reply queues the response to the request with the given ID.
+func (s *lspServer) reply(id json.RawMessage, result any, rpcErr *rpcError) {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	if rpcErr != nil {
+		s.write(map[string]any{"id": id, "error": rpcErr})
+		return
+	}
+	s.write(map[string]any{"id": id, "result": result})
+}
+
+// notify queues a notification to the client.
+func (s *lspServer) notify(method string, params any) {
+	s.write(map[string]any{"method": method, "params": params})
+}
+
+// handle handles a request or notification and returns the result for requests.
+func (s *lspServer) handle(msg rpcMessage) (any, *rpcError) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"positionEncoding": "utf-16",
+				"textDocumentSync": map[string]any{
+					"openClose": true,
+					"change":    2, // Incremental
+				},
+				"codeActionProvider": true,
+			},
+			"serverInfo": map[string]any{"name": "copre"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen", "textDocument/didChange", "textDocument/didClose":
+		var params lspDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &rpcError{codeInvalidParams, err.Error()}
+		}
+		if err := s.sync(msg.Method, params); err != nil {
+			return nil, &rpcError{codeInvalidParams, err.Error()}
+		}
+		return nil, nil
+	case "textDocument/codeAction":
+		var params lspCodeActionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &rpcError{codeInvalidParams, err.Error()}
+		}
+		return s.codeActions(params), nil
+	}
+	if msg.ID == nil {
+		return nil, nil // Unknown notifications, such as "initialized", are ignored
+	}
+	if msg.Method == "" {
+		return nil, &rpcError{codeInvalidRequest, "missing method"}
+	}
+	return nil, &rpcError{codeMethodNotFound, fmt.Sprintf("method %q not found", msg.Method)}
+}
+
+// sync updates the open documents and publishes the predictions for the document.
+func (s *lspServer) sync(method string, params lspDocumentParams) error {
+	uri := params.TextDocument.URI
+	switch method {
+	case "textDocument/didOpen":
+		s.docs[uri] = &lspDocument{
+			version: params.TextDocument.Version,
+			text:    params.TextDocument.Text,
+			session: copre.NewSession(params.TextDocument.Text),
+		}
+	case "textDocument/didClose":
+		delete(s.docs, uri)
+		s.notify("textDocument/publishDiagnostics", map[string]any{"uri": uri, "diagnostics": []lspDiagnostic{}})
+		return nil
+	case "textDocument/didChange":
+		doc, ok := s.docs[uri]
+		if !ok {
+			return fmt.Errorf("document %s is not open", uri)
+		}
+		if params.TextDocument.Version <= doc.version {
+			return nil // An outdated change
+		}
+		for _, change := range params.ContentChanges {
+			if change.Range == nil {
+				doc.text = change.Text
+				continue
+			}
+			index := copre.NewLineIndex(doc.text)
+			start, end := lspOffset(index, change.Range.Start), lspOffset(index, change.Range.End)
+			doc.text = doc.text[:start] + change.Text + doc.text[max(start, end):]
+		}
+		doc.version = params.TextDocument.Version
+		predictions, err := doc.session.Update(doc.text)
+		if err != nil {
+			return err
+		}
+		doc.predictions = predictions
+	}
+
+	doc := s.docs[uri]
+	index := copre.NewLineIndex(doc.text)
+	diagnostics := []lspDiagnostic{}
+	for _, p := range doc.predictions {
+		diagnostics = append(diagnostics, predictionDiagnostic(index, p))
+	}
+	s.notify("textDocument/publishDiagnostics", map[string]any{
+		"uri":         uri,
+		"version":     doc.version,
+		"diagnostics": diagnostics,
+	})
+	return nil
+}
+
+// codeActions returns the actions applying the predictions in the requested range:
+// one per prediction, and one applying every prediction of the document.
+func (s *lspServer) codeActions(params lspCodeActionParams) []lspCodeAction {
+	actions := []lspCodeAction{}
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok || len(doc.predictions) == 0 {
+		return actions
+	}
+	index := copre.NewLineIndex(doc.text)
+	edit := func(predictions ...copre.PredictedChange) lspWorkspaceEdit {
+		edits := []lspTextEdit{}
+		for _, p := range predictions {
+			edits = append(edits, lspTextEdit{Range: lspRangeOf(index, p), NewText: p.TextToAdd})
+		}
+		return lspWorkspaceEdit{Changes: map[string][]lspTextEdit{params.TextDocument.URI: edits}}
+	}
+
+	for _, p := range doc.predictions {
+		r := lspRangeOf(index, p)
+		if lspBefore(r.End, params.Range.Start) || lspBefore(params.Range.End, r.Start) {
+			continue
+		}
+		actions = append(actions, lspCodeAction{
+			Title:       "Apply same change here: " + describePrediction(p),
+			Kind:        "quickfix",
+			Diagnostics: []lspDiagnostic{predictionDiagnostic(index, p)},
+			IsPreferred: true,
+			Edit:        edit(p),
+		})
+	}
+	if len(actions) > 0 && len(doc.predictions) > 1 {
+		// Only predictions that do not conflict with each other can be applied together
+		applied := copre.ApplyPredictions(doc.text, doc.predictions).Applied
+		actions = append(actions, lspCodeAction{
+			Title: fmt.Sprintf("Apply same change to all %d sites", len(applied)),
+			Kind:  "quickfix",
+			Edit:  edit(applied...),
+		})
+	}
+	return actions
+}
+
+// predictionDiagnostic returns the hint shown at a prediction.
+func predictionDiagnostic(index *copre.LineIndex, p copre.PredictedChange) lspDiagnostic {
+	return lspDiagnostic{
+		Range:    lspRangeOf(index, p),
+		Severity: severityHint,
+		Source:   "copre",
+		Message:  "Same change predicted: " + describePrediction(p),
+	}
+}
+
+// lspRangeOf returns the LSP range of the text a prediction changes.
+func lspRangeOf(index *copre.LineIndex, p copre.PredictedChange) lspRange {
+	r := index.Range(p.MappedPosition, p.MappedPosition+len(p.TextToRemove), copre.UnitUTF16)
+	return lspRange{
+		Start: lspPosition{Line: r.Start.Line - 1, Character: r.Start.Column - 1},
+		End:   lspPosition{Line: r.End.Line - 1, Character: r.End.Column - 1},
+	}
+}
+
+// lspOffset returns the byte offset of an LSP position; LSP lines and characters are
+// 0-based.
+func lspOffset(index *copre.LineIndex, pos lspPosition) int {
+	return index.Offset(pos.Line+1, pos.Character+1, copre.UnitUTF16)
+}
+
+// lspBefore reports whether position a comes before b.
+func lspBefore(a, b lspPosition) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Character < b.Character
+}
+
+// describePrediction describes a prediction in a few words.
+func describePrediction(p copre.PredictedChange) string {
+	switch {
+	case p.TextToRemove == "":
+		return fmt.Sprintf("insert %q", p.TextToAdd)
+	case p.TextToAdd == "":
+		return fmt.Sprintf("remove %q", p.TextToRemove)
+	}
+	return fmt.Sprintf("replace %q with %q", p.TextToRemove, p.TextToAdd)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// lspScript frames messages for the server as a client would.
+type lspScript struct {
+	bytes.Buffer
+}
+
+func (s *lspScript) send(msg map[string]any) {
+	msg["jsonrpc"] = "2.0"
+	body, _ := json.Marshal(msg)
+	fmt.Fprintf(s, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+func (s *lspScript) request(id int, method string, params any) {
+	s.send(map[string]any{"id": id, "method": method, "params": params})
+}
+
+func (s *lspScript) notify(method string, params any) {
+	s.send(map[string]any{"method": method, "params": params})
+}
+
+// readLSPMessages parses the messages the server wrote.
+func readLSPMessages(t *testing.T, out []byte) []map[string]any {
+	t.Helper()
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(out)))
+	var messages []map[string]any
+	for {
+		header, err := r.ReadMIMEHeader()
+		if err == io.EOF {
+			return messages
+		}
+		if err != nil {
+			t.Fatalf("reading header: %v", err)
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		if _, err := io.ReadFull(r.R, body); err != nil {
+			t.Fatalf("reading body: %v", err)
+		}
+		var msg map[string]any
+		if err := json.Unmarshal(body, &msg); err != nil {
+			t.Fatalf("unmarshalling %s: %v", body, err)
+		}
+		messages = append(messages, msg)
+	}
+}
+
+// normalize round-trips v through JSON so it compares equal to a decoded message.
+func normalize(v any) any {
+	data, _ := json.Marshal(v)
+	var out any
+	json.Unmarshal(data, &out)
+	return out
+}
+
+func lspRangeAt(line, start, end int) lspRange {
+	return lspRange{Start: lspPosition{line, start}, End: lspPosition{line, end}}
+}
+
+func TestLSP(t *testing.T) {
+	const uri = "file:///tmp/main.go"
+	var script lspScript
+	script.request(1, "initialize", map[string]any{"capabilities": map[string]any{}})
+	script.notify("initialized", map[string]any{})
+	script.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "version": 1, "text": "x := userId\ny := userId\nz := userId\n"},
+	})
+	// Rename the first userId
+	script.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 2},
+		"contentChanges": []any{map[string]any{"range": lspRangeAt(0, 5, 11), "text": "accountId"}},
+	})
+	script.request(2, "textDocument/codeAction", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"range":        lspRangeAt(1, 7, 7),
+	})
+	script.request(3, "textDocument/codeAction", map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"range":        lspRangeAt(0, 0, 3),
+	})
+	script.request(4, "workspace/unknown", nil)
+	script.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": "file:///tmp/closed.go", "version": 2},
+		"contentChanges": []any{map[string]any{"text": ""}},
+	})
+	script.request(5, "shutdown", nil)
+	script.notify("exit", nil)
+
+	var out bytes.Buffer
+	if err := runLSP(&script, &out); err != nil {
+		t.Fatalf("runLSP() error = %v", err)
+	}
+	messages := readLSPMessages(t, out.Bytes())
+	if len(messages) != 8 {
+		t.Fatalf("got %d messages, want 8: %v", len(messages), messages)
+	}
+
+	capabilities := messages[0]["result"].(map[string]any)["capabilities"].(map[string]any)
+	if capabilities["codeActionProvider"] != true {
+		t.Errorf("initialize capabilities = %v, want codeActionProvider", capabilities)
+	}
+
+	hint := func(line int) lspDiagnostic {
+		return lspDiagnostic{
+			Range:    lspRangeAt(line, 5, 11),
+			Severity: severityHint,
+			Source:   "copre",
+			Message:  `Same change predicted: replace "userId" with "accountId"`,
+		}
+	}
+	wantDiagnostics := []map[string]any{
+		{"method": "textDocument/publishDiagnostics", "params": map[string]any{"uri": uri, "version": 1, "diagnostics": []lspDiagnostic{}}},
+		{"method": "textDocument/publishDiagnostics", "params": map[string]any{"uri": uri, "version": 2, "diagnostics": []lspDiagnostic{hint(1), hint(2)}}},
+	}
+	for i, want := range wantDiagnostics {
+		want["jsonrpc"] = "2.0"
+		if got := messages[1+i]; !reflect.DeepEqual(got, normalize(want)) {
+			t.Errorf("message %d = %v, want %v", 1+i, got, normalize(want))
+		}
+	}
+
+	edit := func(lines ...int) lspWorkspaceEdit {
+		edits := []lspTextEdit{}
+		for _, line := range lines {
+			edits = append(edits, lspTextEdit{Range: lspRangeAt(line, 5, 11), NewText: "accountId"})
+		}
+		return lspWorkspaceEdit{Changes: map[string][]lspTextEdit{uri: edits}}
+	}
+	wantActions := []lspCodeAction{
+		{
+			Title:       `Apply same change here: replace "userId" with "accountId"`,
+			Kind:        "quickfix",
+			Diagnostics: []lspDiagnostic{hint(1)},
+			IsPreferred: true,
+			Edit:        edit(1),
+		},
+		{Title: "Apply same change to all 2 sites", Kind: "quickfix", Edit: edit(1, 2)},
+	}
+	if got := messages[3]["result"]; !reflect.DeepEqual(got, normalize(wantActions)) {
+		t.Errorf("codeAction result = %v, want %v", got, normalize(wantActions))
+	}
+	if got := messages[4]["result"]; !reflect.DeepEqual(got, []any{}) {
+		t.Errorf("codeAction away from predictions = %v, want none", got)
+	}
+	if got := messages[5]["error"].(map[string]any)["code"]; got != float64(codeMethodNotFound) {
+		t.Errorf("unknown method error code = %v, want %d", got, codeMethodNotFound)
+	}
+	if got := messages[6]["method"]; got != "window/logMessage" {
+		t.Errorf("change of a closed document sent %v, want window/logMessage", messages[6])
+	}
+	if got, ok := messages[7]["result"]; !ok || got != nil || messages[7]["id"] != float64(5) {
+		t.Errorf("shutdown response = %v, want null result", messages[7])
+	}
+}
+
+func TestLSPIncrementalChangesUTF16(t *testing.T) {
+	// Positions are in UTF-16 code units: the emoji takes two.
+	const uri = "file:///tmp/emoji.txt"
+	var script lspScript
+	script.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "version": 1, "text": "😀 a;\n😀 a;\n"},
+	})
+	script.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 2},
+		"contentChanges": []any{map[string]any{"range": lspRangeAt(0, 4, 5), "text": ""}},
+	})
+
+	var out bytes.Buffer
+	if err := runLSP(&script, &out); err != nil {
+		t.Fatalf("runLSP() error = %v", err)
+	}
+	messages := readLSPMessages(t, out.Bytes())
+	want := normalize([]lspDiagnostic{{
+		Range:    lspRangeAt(1, 4, 5),
+		Severity: severityHint,
+		Source:   "copre",
+		Message:  `Same change predicted: remove ";"`,
+	}})
+	if got := messages[len(messages)-1]["params"].(map[string]any)["diagnostics"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("diagnostics = %v, want %v", got, want)
+	}
+}
+
+func TestLSPExitWithoutShutdown(t *testing.T) {
+	var script lspScript
+	script.notify("exit", nil)
+	if err := runLSP(&script, io.Discard); err == nil {
+		t.Errorf("runLSP() error = nil, want an error for exit without shutdown")
+	}
+}
+
+func TestLSPInvalidContentLength(t *testing.T) {
+	for _, length := range []string{"-1", strconv.Itoa(maxRequestSize + 1), "many"} {
+		in := bytes.NewBufferString("Content-Length: " + length + "\r\n\r\n{}")
+		if err := runLSP(in, io.Discard); err == nil {
+			t.Errorf("runLSP() with Content-Length %s: error = nil, want an error", length)
+		}
+	}
+}
@@ -1,35 +1,62 @@
+// Command copre predicts the next changes to a text from an edit already made, on files
+// or as a server for editors and other tools.
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"log"
-
-	"github.com/jsnanigans/copre/pkg/copre"
+	"io"
+	"os"
 )
 
+const usage = `copre predicts where else an edit should be made.
+
+Usage:
+
+	copre predict [flags] OLD_FILE NEW_FILE    predict from two versions of a file
+	copre git [flags] [PATH...]                predict from the uncommitted edits of a git repository
+	copre patch [flags] PATCH_FILE             predict from a unified diff of the files
+	copre lsp                                  serve the Language Server Protocol on stdio
+	copre serve --stdio | --http ADDR          serve JSON requests on stdio or over HTTP
+
+Run "copre COMMAND -h" for the flags of a command.
+`
+
 func main() {
-	oldText := `line one-two-smile
-line two-smile
-line 3-smile`
-	newText := `line one-two-smile
-line two
-line 3-smile`
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
 
-	predictions, err := copre.PredictNextChanges(oldText, newText)
-	if err != nil {
-		log.Fatalf("Error predicting changes: %v", err)
+// run runs the command given by args and returns the exit status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
 	}
-
-	// Visualize the predictions on the new text
-	if len(predictions) > 0 {
-		fmt.Println("--- Predicted Changes Preview ---")
-		visualizedText := copre.VisualizePredictions(newText, predictions)
-		fmt.Println(visualizedText)
-		fmt.Println("---------------------------------")
-	} else {
-		fmt.Println("No specific next changes predicted based on anchors.")
+	var err error
+	switch args[0] {
+	case "predict":
+		err = predictCommand(args[1:], stdin, stdout, stderr)
+	case "git":
+		err = gitCommand(args[1:], ".", stdout, stderr)
+	case "patch":
+		err = patchCommand(args[1:], stdin, stdout, stderr)
+	case "lsp":
+		err = runLSP(stdin, stdout)
+	case "serve":
+		err = serveCommand(args[1:], stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+	default:
+		fmt.Fprintf(stderr, "copre: unknown command %q\n\n%s", args[0], usage)
+		return 2
 	}
-
-	// Keep the detailed log for debugging if needed
-	// fmt.Printf("Predicted next changes (raw): %+v\n", predictions)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	}
+	fmt.Fprintf(stderr, "copre %s: %v\n", args[0], err)
+	return 1
 }
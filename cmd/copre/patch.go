@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/jsnanigans/copre/pkg/copre"
+)
+
+// patchCommand runs copre patch with the given arguments: it learns the edits from the
+// hunks of a unified diff and predicts the next changes to each patched file, reading
+// the files' current contents from disk.
+func patchCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := newFlagSet("patch", "copre patch [flags] PATCH_FILE (- reads stdin)", stderr)
+	optFlags := addOptionFlags(flags)
+	out := addOutputFlags(flags)
+	dir := flags.String("dir", ".", "the `DIR` the paths in the patch are relative to")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return usageError(flags, "expected PATCH_FILE")
+	}
+	if err := out.check(flags); err != nil {
+		return err
+	}
+
+	patch, err := readInput(flags.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	patches, err := copre.ParsePatch(patch)
+	if err != nil {
+		return err
+	}
+	opts := optFlags.options(stderr)
+	files := []filePredictions{}
+	for _, p := range patches {
+		if p.OldPath == "/dev/null" || p.NewPath == "/dev/null" || len(p.Hunks) == 0 {
+			continue // Added and deleted files have no two versions to predict from
+		}
+		path := filepath.Join(*dir, filepath.FromSlash(p.NewPath))
+		newText, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		predictions, err := copre.PredictFromPatch(context.Background(), p, string(newText), opts)
+		if err != nil && !errors.Is(err, copre.ErrTruncated) {
+			return err
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v; the predictions are partial\n", path, err)
+		}
+		if len(predictions) > 0 {
+			files = append(files, filePredictions{
+				Path:          path,
+				predictResult: predictResult{Predictions: predictions, Truncated: err != nil},
+				text:          string(newText),
+			})
+		}
+	}
+	return writeFilePredictions(stdout, *out, files)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPatchCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.go":     "x := accountId\ny := userId\n",
+		"sub/b.go": "p()\nq.old()\n",
+	})
+	patch := `diff --git a/a.go b/a.go
+--- a/a.go
++++ b/a.go
+@@ -1,2 +1,2 @@
+-x := userId
++x := accountId
+ y := userId
+diff --git a/sub/b.go b/sub/b.go
+--- a/sub/b.go
++++ b/sub/b.go
+@@ -1 +1 @@
+-p.old()
++p()
+diff --git a/new.go b/new.go
+new file mode 100644
+--- /dev/null
++++ b/new.go
+@@ -0,0 +1 @@
++n.old()
+`
+	var stdout, stderr bytes.Buffer
+	if err := patchCommand([]string{"--dir", dir, "-"}, strings.NewReader(patch), &stdout, &stderr); err != nil {
+		t.Fatalf("patchCommand() error = %v (stderr %q)", err, stderr.String())
+	}
+	want := filepath.Join(dir, "a.go") + ":2:6: replace \"userId\" with \"accountId\" (score 9)\n" +
+		filepath.Join(dir, "sub", "b.go") + ":2:2: remove \".old\" (score 7)\n"
+	if stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+
+	// The file no longer matches the patch
+	writeFiles(t, dir, map[string]string{"a.go": "changed\n"})
+	if err := patchCommand([]string{"--dir", dir, "-"}, strings.NewReader(patch), &stdout, &stderr); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("patchCommand() error = %v, want a mismatch", err)
+	}
+}
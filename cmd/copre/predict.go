@@ -0,0 +1,313 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jsnanigans/copre/pkg/copre"
+)
+
+// errUsage reports invalid arguments; the command has already printed its usage.
+var errUsage = errors.New("invalid usage")
+
+// newFlagSet returns a flag set for a command, printing errors and usage to stderr.
+func newFlagSet(name, usage string, stderr io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(stderr, "usage: %s\n", usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseFlags parses args, returning errUsage if they are invalid and flag.ErrHelp if
+// help was requested.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		return errUsage
+	}
+	return err
+}
+
+// usageError prints a message about invalid arguments and the usage of flags, and
+// returns errUsage.
+func usageError(flags *flag.FlagSet, format string, args ...any) error {
+	fmt.Fprintf(flags.Output(), "copre %s: %s\n", flags.Name(), fmt.Sprintf(format, args...))
+	flags.Usage()
+	return errUsage
+}
+
+// optionFlags are the flags that set copre.Options.
+type optionFlags struct {
+	opts  copre.Options
+	debug bool
+}
+
+// addOptionFlags defines the flags setting copre.Options on flags.
+func addOptionFlags(flags *flag.FlagSet) *optionFlags {
+	f := &optionFlags{}
+	flags.TextVar(&f.opts.DiffMode, "diff-mode", copre.DiffSemantic, "diff granularity `mode`: semantic, chars, words or lines")
+	flags.IntVar(&f.opts.MinScore, "min-score", 0, "drop predictions scoring below `N`")
+	flags.IntVar(&f.opts.MaxResults, "max-results", 0, "return at most `N` predictions")
+	flags.IntVar(&f.opts.ContextWidth, "context-width", 0, "compare at most `N` runes of context on each side when scoring")
+	flags.BoolVar(&f.opts.CaseInsensitive, "case-insensitive", false, "find other occurrences of the changed text regardless of case")
+	flags.BoolVar(&f.opts.CasePreserving, "case-preserving", false, "also predict the case variants of a replacement")
+	flags.TextVar(&f.opts.Sort, "sort", copre.SortByScore, "`order` of the predictions: score, position or none")
+	flags.DurationVar(&f.opts.Timeout, "timeout", 0, "time budget of a prediction; partial predictions are printed when it runs out")
+	flags.TextVar(&f.opts.RangeUnit, "range-unit", copre.PositionUnit(0), "add the range of each prediction to JSON output, with columns in `unit`s: bytes, runes or utf16")
+	flags.BoolVar(&f.debug, "debug", false, "log each stage of the prediction to stderr")
+	return f
+}
+
+// options returns the options the flags set, logging to stderr with -debug.
+func (f *optionFlags) options(stderr io.Writer) copre.Options {
+	opts := f.opts
+	if f.debug {
+		opts.Logger = slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+	return opts
+}
+
+// outputFormats are the values of the -format flag.
+var outputFormats = []string{"text", "json", "visualize", "patch"}
+
+// output is how predictions are printed, as set by the output flags.
+type output struct {
+	format       string
+	contextLines int // Of the patch format
+}
+
+// addOutputFlags defines the flags setting the output on flags.
+func addOutputFlags(flags *flag.FlagSet) *output {
+	out := &output{}
+	flags.StringVar(&out.format, "format", "text", "output `format`: "+strings.Join(outputFormats, ", "))
+	flags.IntVar(&out.contextLines, "context-lines", 3, "lines of context around each change with -format=patch")
+	return out
+}
+
+// check returns an error unless the output flags are valid.
+func (o *output) check(flags *flag.FlagSet) error {
+	if !slices.Contains(outputFormats, o.format) {
+		return usageError(flags, "unknown format %q (want %s)", o.format, strings.Join(outputFormats, ", "))
+	}
+	if o.contextLines < 0 {
+		return usageError(flags, "-context-lines must not be negative")
+	}
+	return nil
+}
+
+// predictCommand runs copre predict with the given arguments: it predicts the next
+// changes from the old to the new version of a file and prints them.
+func predictCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := newFlagSet("predict", "copre predict [flags] OLD_FILE NEW_FILE (- reads stdin)", stderr)
+	optFlags := addOptionFlags(flags)
+	out := addOutputFlags(flags)
+	across := flags.String("across", "", "also predict in the files of the tree at `DIR`, honoring .gitignore files")
+	var include, exclude globList
+	flags.Var(&include, "include", "with -across, only search files matching the `glob` (repeatable)")
+	flags.Var(&exclude, "exclude", "with -across, skip files and directories matching the `glob` (repeatable)")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return usageError(flags, "expected OLD_FILE and NEW_FILE")
+	}
+	if flags.Arg(0) == "-" && flags.Arg(1) == "-" {
+		return usageError(flags, "only one of OLD_FILE and NEW_FILE can be stdin")
+	}
+	if err := out.check(flags); err != nil {
+		return err
+	}
+
+	oldText, err := readInput(flags.Arg(0), stdin)
+	if err != nil {
+		return err
+	}
+	newText, err := readInput(flags.Arg(1), stdin)
+	if err != nil {
+		return err
+	}
+	name := flags.Arg(1)
+	if name == "-" {
+		name = "<stdin>"
+	}
+	if *across != "" {
+		oldName := flags.Arg(0)
+		if oldName == "-" {
+			oldName = ""
+		}
+		return predictAcross(stdout, stderr, *out, oldName, name, oldText, newText, *across, include, exclude, optFlags.options(stderr))
+	}
+
+	predictions, err := copre.PredictWithOptions(context.Background(), oldText, newText, optFlags.options(stderr))
+	if err != nil && !errors.Is(err, copre.ErrTruncated) {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%v; the predictions are partial\n", err)
+	}
+	return writePredictions(stdout, *out, name, newText, predictions, err != nil)
+}
+
+// predictAcross predicts the edit from oldText to newText, the versions of the named
+// file, in that file and in the files of the tree at root, and writes the predictions
+// grouped by file. The file oldName holding oldText, if any, is not searched.
+func predictAcross(stdout, stderr io.Writer, out output, oldName, name, oldText, newText, root string, include, exclude globList, opts copre.Options) error {
+	found, err := collectFiles(root, include, exclude)
+	if err != nil {
+		return err
+	}
+	// Compare paths in absolute form, so the edited file and its old version are
+	// recognized in the tree and its siblings are found however the paths were given
+	edited := absPath(name)
+	old := ""
+	if oldName != "" {
+		old = absPath(oldName)
+	}
+	texts := map[string]string{edited: newText}
+	files := []copre.File{}
+	for _, f := range found {
+		f.Path = absPath(f.Path)
+		if f.Path != edited && f.Path != old {
+			texts[f.Path] = f.Text
+			files = append(files, f)
+		}
+	}
+
+	predictions, err := copre.PredictAcrossFiles(context.Background(), edited, oldText, newText, files, opts)
+	if err != nil && !errors.Is(err, copre.ErrTruncated) {
+		return err
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%v; the predictions are partial\n", err)
+	}
+
+	// Group the predictions by file, in the order of each file's first prediction
+	var groups []filePredictions
+	index := map[string]int{}
+	for _, p := range predictions {
+		i, ok := index[p.Path]
+		if !ok {
+			i = len(groups)
+			index[p.Path] = i
+			groups = append(groups, filePredictions{
+				Path:          displayPath(p.Path, name, edited),
+				predictResult: predictResult{Predictions: []copre.PredictedChange{}, Truncated: err != nil},
+				text:          texts[p.Path],
+			})
+		}
+		groups[i].Predictions = append(groups[i].Predictions, p.PredictedChange)
+	}
+	if groups == nil {
+		groups = []filePredictions{}
+	}
+	return writeFilePredictions(stdout, out, groups)
+}
+
+// absPath returns the absolute form of path, or path itself if it has none.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// displayPath returns how to show path, an absolute path from predictAcross: as name for
+// the edited file, and otherwise relative to the current directory if possible.
+func displayPath(path, name, edited string) string {
+	if path == edited {
+		return name
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+	}
+	return path
+}
+
+// readInput returns the contents of the named file, or of stdin for "-".
+func readInput(name string, stdin io.Reader) (string, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	return string(data), err
+}
+
+// filePredictions are the predictions for one of several files.
+type filePredictions struct {
+	Path string `json:"path"`
+	predictResult
+	text string // The text the predictions refer to
+}
+
+// writeFilePredictions writes the predictions for several files, grouped by file. The
+// JSON format is an object with the list of files, and the patch format one patch for
+// all files.
+func writeFilePredictions(w io.Writer, out output, files []filePredictions) error {
+	if out.format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(map[string]any{"files": files})
+	}
+	for i, f := range files {
+		if out.format == "visualize" {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "--- %s\n", f.Path)
+		}
+		if err := writePredictions(w, out, f.Path, f.text, f.Predictions, f.Truncated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writePredictions writes the predictions for text, the contents of the named file, in
+// the given format. The text format has a line per prediction, giving its 1-based line
+// and byte column like compiler messages do.
+func writePredictions(w io.Writer, out output, name, text string, predictions []copre.PredictedChange, truncated bool) error {
+	switch out.format {
+	case "json":
+		if predictions == nil {
+			predictions = []copre.PredictedChange{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(predictResult{Predictions: predictions, Truncated: truncated})
+	case "visualize":
+		_, err := fmt.Fprintln(w, copre.VisualizePredictions(text, predictions))
+		return err
+	case "patch":
+		// -context-lines=0 maps to PatchOptions.Context = -1, since a zero Context means
+		// the default of 3 lines
+		contextLines := cmp.Or(out.contextLines, -1)
+		_, err := io.WriteString(w, copre.RenderPatch(filepath.ToSlash(name), text, predictions, copre.PatchOptions{Context: contextLines}))
+		return err
+	}
+	index := copre.NewLineIndex(text)
+	for _, p := range predictions {
+		loc := index.Location(p.MappedPosition, copre.UnitBytes)
+		if _, err := fmt.Fprintf(w, "%s:%d:%d: %s (score %d)\n", name, loc.Line, loc.Column, describePrediction(p), p.Score); err != nil {
+			return err
+		}
+	}
+	return nil
+}
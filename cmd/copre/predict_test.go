@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jsnanigans/copre/pkg/copre"
+)
+
+func TestPredictCommand(t *testing.T) {
+	dir := t.TempDir()
+	oldFile := filepath.Join(dir, "old.go")
+	newFile := filepath.Join(dir, "new.go")
+	os.WriteFile(oldFile, []byte("x := userId\ny := userId\nz := userId\n"), 0o644)
+	os.WriteFile(newFile, []byte("x := accountId\ny := userId\nz := userId\n"), 0o644)
+
+	tests := []struct {
+		name       string
+		args       []string
+		stdin      string
+		wantStatus int
+		wantOut    string
+		wantErr    string // A substring of the expected stderr
+	}{
+		{
+			name:    "files",
+			args:    []string{"predict", oldFile, newFile},
+			wantOut: newFile + ":2:6: replace \"userId\" with \"accountId\" (score 9)\n" + newFile + ":3:6: replace \"userId\" with \"accountId\" (score 9)\n",
+		},
+		{
+			name:    "new text on stdin, with options",
+			args:    []string{"predict", "--max-results", "1", "--sort", "position", oldFile, "-"},
+			stdin:   "x := accountId\ny := userId\nz := userId\n",
+			wantOut: "<stdin>:2:6: replace \"userId\" with \"accountId\" (score 9)\n",
+		},
+		{
+			name:    "nothing to predict",
+			args:    []string{"predict", oldFile, oldFile},
+			wantOut: "",
+		},
+		{
+			name:       "missing file",
+			args:       []string{"predict", oldFile, filepath.Join(dir, "missing.go")},
+			wantStatus: 1,
+			wantErr:    "missing.go",
+		},
+		{
+			name:       "both stdin",
+			args:       []string{"predict", "-", "-"},
+			wantStatus: 2,
+			wantErr:    "only one of OLD_FILE and NEW_FILE can be stdin",
+		},
+		{
+			name:       "one file",
+			args:       []string{"predict", oldFile},
+			wantStatus: 2,
+			wantErr:    "usage: copre predict",
+		},
+		{
+			name:       "invalid option",
+			args:       []string{"predict", "--diff-mode", "bytes", oldFile, newFile},
+			wantStatus: 2,
+			wantErr:    `unknown diff mode "bytes"`,
+		},
+		{
+			name:       "unknown format",
+			args:       []string{"predict", "--format", "xml", oldFile, newFile},
+			wantStatus: 2,
+			wantErr:    `unknown format "xml"`,
+		},
+		{
+			name:       "unknown command",
+			args:       []string{"guess"},
+			wantStatus: 2,
+			wantErr:    `unknown command "guess"`,
+		},
+		{
+			name:       "no command",
+			wantStatus: 2,
+			wantErr:    "Usage:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d (stderr %q)", status, tt.wantStatus, stderr.String())
+			}
+			if tt.wantStatus == 0 && stdout.String() != tt.wantOut {
+				t.Errorf("stdout = %q, want %q", stdout.String(), tt.wantOut)
+			}
+			if !strings.Contains(stderr.String(), tt.wantErr) {
+				t.Errorf("stderr = %q, want it to contain %q", stderr.String(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPredictCommandJSON(t *testing.T) {
+	dir := t.TempDir()
+	oldFile := filepath.Join(dir, "old.txt")
+	os.WriteFile(oldFile, []byte("a.old\nb.old\n"), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"predict", "--format=json", "--range-unit=runes", oldFile, "-"}, strings.NewReader("a\nb.old\n"), &stdout, &stderr)
+	if status != 0 {
+		t.Fatalf("status = %d, stderr %q", status, stderr.String())
+	}
+	var got predictResult
+	if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+		t.Fatalf("unmarshalling %s: %v", stdout.Bytes(), err)
+	}
+	want := predictResult{Predictions: []copre.PredictedChange{{
+		Position:       7,
+		TextToRemove:   ".old",
+		Line:           2,
+		Score:          5,
+		MappedPosition: 3,
+		Range: &copre.Range{
+			Start: copre.Location{Offset: 3, Rune: 3, Line: 2, Column: 2},
+			End:   copre.Location{Offset: 7, Rune: 7, Line: 2, Column: 6},
+			Unit:  copre.UnitRunes,
+		},
+	}}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("predict --format=json = %+v, want %+v", got, want)
+	}
+}
+
+func TestPredictCommandAcross(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"pkg/a.go":      "x := accountId\ny := userId\n",
+		"pkg/b.go":      "z := userId\n",
+		"cmd/main.go":   "v := userId\n",
+		"cmd/main.txt":  "userId\n",
+		"gen/gen.go":    "w := userId\n",
+		".gitignore":    "gen/\n",
+		"old/a.go.orig": "x := userId\ny := userId\n",
+	})
+	t.Chdir(dir)
+
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"predict", "--across", ".", "--include", "*.go", "old/a.go.orig", "pkg/a.go"}, nil, &stdout, &stderr)
+	if status != 0 {
+		t.Fatalf("status = %d, stderr %q", status, stderr.String())
+	}
+	want := "pkg/a.go:2:6: replace \"userId\" with \"accountId\" (score 12)\n" +
+		"pkg/b.go:1:6: replace \"userId\" with \"accountId\" (score 10)\n" +
+		"cmd/main.go:1:6: replace \"userId\" with \"accountId\" (score 9)\n"
+	if stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestPredictCommandAcrossOldFileInTree(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.go":     "x := accountId\ny := userId\n",
+		"a_old.go": "x := userId\ny := userId\n",
+		"b.go":     "z := userId\n",
+	})
+	t.Chdir(dir)
+
+	// The old version is in the searched tree, but is not a file to edit
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"predict", "--across", ".", "a_old.go", "a.go"}, nil, &stdout, &stderr)
+	if status != 0 {
+		t.Fatalf("status = %d, stderr %q", status, stderr.String())
+	}
+	want := "a.go:2:6: replace \"userId\" with \"accountId\" (score 12)\n" +
+		"b.go:1:6: replace \"userId\" with \"accountId\" (score 10)\n"
+	if stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+}
+
+func TestPredictCommandPatch(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"old.go": "x := userId\n\ny := userId\nz := userId\n",
+		"new.go": "x := accountId\n\ny := userId\nz := userId\n",
+	})
+	t.Chdir(dir)
+
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"predict", "--format=patch", "--context-lines=1", "--min-score=1", "old.go", "new.go"}, nil, &stdout, &stderr)
+	if status != 0 {
+		t.Fatalf("status = %d, stderr %q", status, stderr.String())
+	}
+	want := `--- a/new.go
++++ b/new.go
+@@ -2,3 +2,3 @@
+ 
+-y := userId
+-z := userId
++y := accountId
++z := accountId
+`
+	if stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+
+	status = run([]string{"predict", "--format=patch", "--context-lines=-1", "old.go", "new.go"}, nil, &stdout, &stderr)
+	if status != 2 {
+		t.Errorf("status with negative context lines = %d, want 2", status)
+	}
+}
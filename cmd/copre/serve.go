@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/jsnanigans/copre/pkg/copre"
+)
+
+// maxRequestSize is the largest request copre serve and copre lsp accept, in bytes.
+const maxRequestSize = 16 << 20
+
+// defaultMaxDocuments is how many documents copre serve keeps open by default.
+const defaultMaxDocuments = 1000
+
+// serveCommand runs copre serve with the given arguments.
+func serveCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := newFlagSet("serve", "copre serve --stdio | --http ADDR", stderr)
+	stdio := flags.Bool("stdio", false, "serve newline-delimited JSON requests on stdin and stdout")
+	addr := flags.String("http", "", "serve HTTP requests on `ADDR`, such as :8080")
+	maxDocuments := flags.Int("max-documents", defaultMaxDocuments, "keep at most `N` documents open, closing the least recently used one to open another")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *maxDocuments < 1 {
+		return usageError(flags, "-max-documents must be positive")
+	}
+	switch {
+	case *stdio && *addr == "":
+		return runServeStdio(stdin, stdout, *maxDocuments)
+	case *addr != "" && !*stdio:
+		return runServeHTTP(*addr, stdout, *maxDocuments)
+	}
+	return usageError(flags, "expected exactly one of --stdio and --http")
+}
+
+// requestOptions are the copre.Options a request can set.
+type requestOptions struct {
+	DiffMode        copre.DiffMode     `json:"diffMode"`
+	MinScore        int                `json:"minScore"`
+	MaxResults      int                `json:"maxResults"`
+	ContextWidth    int                `json:"contextWidth"`
+	CaseInsensitive bool               `json:"caseInsensitive"`
+	CasePreserving  bool               `json:"casePreserving"`
+	Sort            copre.SortOrder    `json:"sort"`
+	RangeUnit       copre.PositionUnit `json:"rangeUnit"`
+	TimeoutMillis   int                `json:"timeoutMs"`
+}
+
+func (o requestOptions) options() copre.Options {
+	return copre.Options{
+		DiffMode:        o.DiffMode,
+		MinScore:        o.MinScore,
+		MaxResults:      o.MaxResults,
+		ContextWidth:    o.ContextWidth,
+		CaseInsensitive: o.CaseInsensitive,
+		CasePreserving:  o.CasePreserving,
+		Sort:            o.Sort,
+		RangeUnit:       o.RangeUnit,
+		Timeout:         time.Duration(o.TimeoutMillis) * time.Millisecond,
+	}
+}
+
+// predictParams are the parameters of predict and explain. A prediction is made either
+// from OldText to NewText, or, for predict, for the next version Text of a Document.
+type predictParams struct {
+	Document string         `json:"document"`
+	Text     string         `json:"text"`
+	OldText  string         `json:"oldText"`
+	NewText  string         `json:"newText"`
+	Options  requestOptions `json:"options"`
+}
+
+// predictResult is the result of predict and explain.
+type predictResult struct {
+	Predictions []copre.PredictedChange `json:"predictions"`
+	Truncated   bool                    `json:"truncated,omitempty"` // The time budget ran out; the predictions are partial
+	Trace       *copre.Trace            `json:"trace,omitempty"`     // Only for explain
+}
+
+// applyParams are the parameters of apply: the predictions to apply to Text, or to the
+// current text of Document.
+type applyParams struct {
+	Document    string                  `json:"document"`
+	Text        string                  `json:"text"`
+	Predictions []copre.PredictedChange `json:"predictions"`
+}
+
+// applyResult is the result of apply. For a document, the applied text becomes its next
+// version and Predictions are the predictions for it.
+type applyResult struct {
+	copre.ApplyResult
+	Predictions []copre.PredictedChange `json:"predictions,omitempty"`
+}
+
+// visualizeParams are the parameters of visualize: the predictions to highlight in Text.
+type visualizeParams struct {
+	Text        string                  `json:"text"`
+	Predictions []copre.PredictedChange `json:"predictions"`
+}
+
+// visualizeResult is the result of visualize: Text with the predictions highlighted
+// by ANSI escape codes.
+type visualizeResult struct {
+	Text string `json:"text"`
+}
+
+// closeParams are the parameters of close.
+type closeParams struct {
+	Document string `json:"document"`
+}
+
+// server carries out the requests of copre serve. It keeps a Session per document, so
+// predictions for a document draw on all of its versions, and is safe for concurrent use.
+// Requests for different documents run in parallel. At most maxDocs documents are open:
+// opening another closes the least recently used one.
+type server struct {
+	mu      sync.Mutex // Guards docs and clock only; each document has its own lock
+	docs    map[string]*document
+	maxDocs int
+	clock   uint64 // Counts the uses of documents, to find the least recently used one
+}
+
+// document is an open document of copre serve.
+type document struct {
+	// mu is held by a request for its whole change to the document, so that the text
+	// an apply reads is still current when it records the result
+	mu       sync.Mutex
+	session  *copre.Session
+	lastUsed uint64 // The server's clock when the document was last used; guarded by the server's mu
+}
+
+func newServer(maxDocs int) *server {
+	return &server{docs: make(map[string]*document), maxDocs: maxDocs}
+}
+
+// lookup returns the open document called name, or nil if it is not open, and marks it
+// as used.
+func (s *server) lookup(name string) *document {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.use(name)
+}
+
+// use returns the open document called name, or nil, and marks it as used. The caller
+// must hold s.mu.
+func (s *server) use(name string) *document {
+	doc := s.docs[name]
+	if doc != nil {
+		s.clock++
+		doc.lastUsed = s.clock
+	}
+	return doc
+}
+
+// open opens a document called name on session, closing the least recently used
+// document if maxDocs are open. The caller must hold s.mu.
+func (s *server) open(name string, session *copre.Session) {
+	if len(s.docs) >= s.maxDocs {
+		oldest := ""
+		for n, doc := range s.docs {
+			if oldest == "" || doc.lastUsed < s.docs[oldest].lastUsed {
+				oldest = n
+			}
+		}
+		delete(s.docs, oldest)
+	}
+	s.docs[name] = &document{session: session}
+	s.use(name)
+}
+
+// call carries out the request method with the JSON-encoded params.
+func (s *server) call(ctx context.Context, method string, params json.RawMessage) (any, *rpcError) {
+	switch method {
+	case "predict", "explain":
+		var p predictParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		if method == "explain" {
+			return s.explain(ctx, p)
+		}
+		return s.predict(ctx, p)
+	case "apply":
+		var p applyParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.apply(ctx, p)
+	case "visualize":
+		var p visualizeParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return visualizeResult{Text: copre.VisualizePredictions(p.Text, p.Predictions)}, nil
+	case "close":
+		var p closeParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.docs[p.Document]; !ok {
+			return nil, &rpcError{codeInvalidParams, fmt.Sprintf("document %q is not open", p.Document)}
+		}
+		delete(s.docs, p.Document)
+		return struct{}{}, nil
+	case "":
+		return nil, &rpcError{codeInvalidRequest, "missing method"}
+	}
+	return nil, &rpcError{codeMethodNotFound, fmt.Sprintf("method %q not found", method)}
+}
+
+// decodeParams decodes params into v, rejecting unknown fields.
+func decodeParams(params json.RawMessage, v any) *rpcError {
+	if len(params) == 0 {
+		return &rpcError{codeInvalidParams, "missing params"}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return &rpcError{codeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+// predict predicts from OldText to NewText or, for a document, from its first version
+// to Text. The first request for a document opens it with Text, using its options for
+// the rest of the session, and predicts nothing.
+func (s *server) predict(ctx context.Context, p predictParams) (predictResult, *rpcError) {
+	if p.Document == "" {
+		predictions, err := copre.PredictWithOptions(ctx, p.OldText, p.NewText, p.Options.options())
+		return predictionResult(predictions, nil, err)
+	}
+	if p.OldText != "" || p.NewText != "" {
+		return predictResult{}, &rpcError{codeInvalidParams, "a document is predicted from its text, not oldText and newText"}
+	}
+
+	s.mu.Lock()
+	doc := s.use(p.Document)
+	if doc == nil {
+		s.open(p.Document, copre.NewSessionWithOptions(p.Text, p.Options.options()))
+	}
+	s.mu.Unlock()
+	if doc == nil {
+		return predictResult{Predictions: []copre.PredictedChange{}}, nil
+	}
+
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+	predictions, err := doc.session.UpdateContext(ctx, p.Text)
+	return predictionResult(predictions, nil, err)
+}
+
+// explain predicts from OldText to NewText and traces the prediction.
+func (s *server) explain(ctx context.Context, p predictParams) (predictResult, *rpcError) {
+	if p.Document != "" || p.Text != "" {
+		return predictResult{}, &rpcError{codeInvalidParams, "explain takes oldText and newText"}
+	}
+	predictions, trace, err := copre.Explain(ctx, p.OldText, p.NewText, p.Options.options())
+	return predictionResult(predictions, trace, err)
+}
+
+// predictionResult turns the outcome of a prediction into a result, reporting a
+// truncated prediction as partial rather than failed.
+func predictionResult(predictions []copre.PredictedChange, trace *copre.Trace, err error) (predictResult, *rpcError) {
+	if err != nil && !errors.Is(err, copre.ErrTruncated) {
+		return predictResult{}, &rpcError{codeRequestFailed, err.Error()}
+	}
+	if predictions == nil {
+		predictions = []copre.PredictedChange{}
+	}
+	return predictResult{Predictions: predictions, Truncated: err != nil, Trace: trace}, nil
+}
+
+// apply applies predictions to Text or to the current text of a document, which then
+// becomes the document's next version.
+func (s *server) apply(ctx context.Context, p applyParams) (applyResult, *rpcError) {
+	if p.Document == "" {
+		return applyResult{ApplyResult: copre.ApplyPredictions(p.Text, p.Predictions)}, nil
+	}
+	if p.Text != "" {
+		return applyResult{}, &rpcError{codeInvalidParams, "predictions are applied to the document's current text, not text"}
+	}
+
+	doc := s.lookup(p.Document)
+	if doc == nil {
+		return applyResult{}, &rpcError{codeInvalidParams, fmt.Sprintf("document %q is not open", p.Document)}
+	}
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+	result := applyResult{ApplyResult: copre.ApplyPredictions(doc.session.Text(), p.Predictions)}
+	predictions, err := doc.session.UpdateContext(ctx, result.Text)
+	if err != nil && !errors.Is(err, copre.ErrTruncated) {
+		return applyResult{}, &rpcError{codeRequestFailed, err.Error()}
+	}
+	result.Predictions = predictions
+	return result, nil
+}
+
+// runServeStdio serves newline-delimited JSON-RPC requests from in, writing one response
+// line to out per request, until in is exhausted. At most maxDocs documents are open.
+func runServeStdio(in io.Reader, out io.Writer, maxDocs int) error {
+	s := newServer(maxDocs)
+	reader := bufio.NewReader(in)
+	encoder := json.NewEncoder(out)
+	for {
+		line, err := readLine(reader, maxRequestSize)
+		if err == io.EOF {
+			return nil
+		}
+		response := map[string]any{"jsonrpc": "2.0", "id": nil}
+		var msg rpcMessage
+		switch {
+		case errors.Is(err, errLineTooLong):
+			response["error"] = &rpcError{codeInvalidRequest, err.Error()}
+		case err != nil:
+			return err
+		case len(bytes.TrimSpace(line)) == 0:
+			continue
+		default:
+			if err := json.Unmarshal(line, &msg); err != nil {
+				response["error"] = &rpcError{codeParseError, err.Error()}
+				break
+			}
+			result, rpcErr := s.call(context.Background(), msg.Method, msg.Params)
+			if msg.ID == nil {
+				continue // A notification gets no response
+			}
+			response["id"] = msg.ID
+			if rpcErr != nil {
+				response["error"] = rpcErr
+			} else {
+				response["result"] = result
+			}
+		}
+		if err := encoder.Encode(response); err != nil {
+			return err
+		}
+	}
+}
+
+var errLineTooLong = fmt.Errorf("request exceeds %d bytes", maxRequestSize)
+
+// readLine reads the next line from r without its line ending. A line longer than limit
+// is skipped, returning errLineTooLong.
+func readLine(r *bufio.Reader, limit int) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			line = append(line, chunk...)
+			if tooLong = len(bytes.TrimRight(line, "\r\n")) > limit; tooLong {
+				line = nil
+			}
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err != nil && err != io.EOF:
+			return nil, err
+		case tooLong:
+			return nil, errLineTooLong
+		case err == io.EOF && len(line) == 0:
+			return nil, io.EOF
+		}
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// serveStdio runs the stdio server on the request lines and returns the decoded
+// response lines.
+func serveStdio(t *testing.T, requests ...string) []map[string]any {
+	t.Helper()
+	var out bytes.Buffer
+	if err := runServeStdio(strings.NewReader(strings.Join(requests, "\n")), &out, defaultMaxDocuments); err != nil {
+		t.Fatalf("runServeStdio() error = %v", err)
+	}
+	var responses []map[string]any
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var response map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			t.Fatalf("response %s: %v", scanner.Bytes(), err)
+		}
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+func TestServeStdio(t *testing.T) {
+	responses := serveStdio(t,
+		`{"id": 1, "method": "predict", "params": {"oldText": "a-x\nb-x", "newText": "a\nb-x", "options": {"rangeUnit": "runes"}}}`,
+		`{"id": "open", "method": "predict", "params": {"document": "doc", "text": "first.old()\nsecond.old()\nthird.old()"}}`,
+		`{"id": 2, "method": "predict", "params": {"document": "doc", "text": "first()\nsecond.old()\nthird.old()"}}`,
+		`{"id": 3, "method": "apply", "params": {"document": "doc", "predictions": [{"textToRemove": ".old", "mappedPosition": 14}]}}`,
+		`{"id": 4, "method": "explain", "params": {"oldText": "a-x\nb-x", "newText": "a\nb-x"}}`,
+		`{"id": 5, "method": "close", "params": {"document": "doc"}}`,
+		``,
+		`{"method": "predict", "params": {"document": "quiet", "text": "x"}}`,
+		`{"id": 6, "method": "close", "params": {"document": "quiet"}}`,
+	)
+	// The notification opening "quiet" gets no response, but is carried out
+	if len(responses) != 7 {
+		t.Fatalf("got %d responses, want 7: %v", len(responses), responses)
+	}
+
+	want := map[string]any{
+		"jsonrpc": "2.0",
+		"id":      float64(1),
+		"result": map[string]any{"predictions": []any{map[string]any{
+			"position": float64(5), "textToRemove": "-x", "textToAdd": "", "line": float64(2), "score": float64(5), "mappedPosition": float64(3),
+			"range": map[string]any{
+				"start": map[string]any{"offset": float64(3), "rune": float64(3), "line": float64(2), "column": float64(2)},
+				"end":   map[string]any{"offset": float64(5), "rune": float64(5), "line": float64(2), "column": float64(4)},
+				"unit":  "runes",
+			},
+		}}},
+	}
+	if !reflect.DeepEqual(responses[0], want) {
+		t.Errorf("predict = %v, want %v", responses[0], want)
+	}
+
+	// Opening the document predicts nothing; the next version predicts the other sites.
+	if got := responses[1]["result"]; !reflect.DeepEqual(got, map[string]any{"predictions": []any{}}) || responses[1]["id"] != "open" {
+		t.Errorf("predict (open) = %v, want no predictions", responses[1])
+	}
+	if got := responses[2]["result"].(map[string]any)["predictions"].([]any); len(got) != 2 {
+		t.Errorf("predict (document) = %v, want 2 predictions", got)
+	}
+
+	// Applying one prediction updates the document, which still predicts the last site.
+	applied := responses[3]["result"].(map[string]any)
+	if want := "first()\nsecond()\nthird.old()"; applied["text"] != want {
+		t.Errorf("apply text = %q, want %q", applied["text"], want)
+	}
+	if got, _ := applied["predictions"].([]any); len(got) != 1 || got[0].(map[string]any)["mappedPosition"] != float64(22) {
+		t.Errorf("apply predictions = %v, want the site on line 3", got)
+	}
+
+	trace := responses[4]["result"].(map[string]any)["trace"].(map[string]any)
+	if candidates := trace["candidates"].([]any); len(candidates) != 1 {
+		t.Errorf("explain candidates = %v, want 1", candidates)
+	}
+	if got := responses[5]["result"]; !reflect.DeepEqual(got, map[string]any{}) {
+		t.Errorf("close = %v, want {}", got)
+	}
+	if got := responses[6]["result"]; !reflect.DeepEqual(got, map[string]any{}) || responses[6]["id"] != float64(6) {
+		t.Errorf("close (opened by a notification) = %v, want {}", responses[6])
+	}
+}
+
+func TestServeStdioErrors(t *testing.T) {
+	responses := serveStdio(t,
+		`{"id": 1, "method": "predict"`,
+		`{"id": 2, "method": "unknown", "params": {}}`,
+		`{"id": 3, "method": "predict", "params": {"oldText": "a", "newTxt": "b"}}`,
+		`{"id": 4, "method": "apply", "params": {"document": "missing", "predictions": []}}`,
+		`{"id": 5, "method": "predict", "params": {"oldText": "a", "newText": "b", "options": {"diffMode": "bytes"}}}`,
+		`{"id": 6, "method": "close", "params": {"document": "missing"}}`,
+	)
+	wantCodes := []int{codeParseError, codeMethodNotFound, codeInvalidParams, codeInvalidParams, codeInvalidParams, codeInvalidParams}
+	if len(responses) != len(wantCodes) {
+		t.Fatalf("got %d responses, want %d: %v", len(responses), len(wantCodes), responses)
+	}
+	for i, response := range responses {
+		rpcErr, ok := response["error"].(map[string]any)
+		if !ok || rpcErr["code"] != float64(wantCodes[i]) || rpcErr["message"] == "" {
+			t.Errorf("response %d = %v, want error code %d", i, response, wantCodes[i])
+		}
+	}
+	if responses[0]["id"] != nil || responses[1]["id"] != float64(2) {
+		t.Errorf("response ids = %v, %v, want null and 2", responses[0]["id"], responses[1]["id"])
+	}
+}
+
+func TestReadLine(t *testing.T) {
+	long := strings.Repeat("x", 40)
+	r := bufio.NewReaderSize(strings.NewReader("short\r\n"+long+"\nlast"), 16)
+	for _, want := range []string{"short", "", "last", ""} {
+		line, err := readLine(r, 32)
+		switch want {
+		case "":
+			if err == nil {
+				t.Fatalf("readLine() = %q, want an error", line)
+			}
+		default:
+			if err != nil || string(line) != want {
+				t.Fatalf("readLine() = %q, %v, want %q", line, err, want)
+			}
+		}
+	}
+}
+
+func TestServerDocumentContext(t *testing.T) {
+	s := newServer(defaultMaxDocuments)
+	open := predictParams{Document: "doc", Text: "alpha-x\nbeta-x\ngamma-x"}
+	if _, rpcErr := s.predict(context.Background(), open); rpcErr != nil {
+		t.Fatalf("predict (open) error = %v", rpcErr)
+	}
+
+	// A request whose client has gone away stops predicting, but the version is kept
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got, rpcErr := s.predict(ctx, predictParams{Document: "doc", Text: "alpha\nbeta-x\ngamma-x"})
+	if rpcErr != nil || !got.Truncated || len(got.Predictions) != 0 {
+		t.Errorf("predict (cancelled) = %+v, %v, want truncated with no predictions", got, rpcErr)
+	}
+	if text := s.lookup("doc").session.Text(); text != "alpha\nbeta-x\ngamma-x" {
+		t.Errorf("document text = %q, want the new version", text)
+	}
+}
+
+func TestServerMaxDocuments(t *testing.T) {
+	s := newServer(2)
+	for _, name := range []string{"a", "b", "a", "c"} {
+		if _, rpcErr := s.predict(context.Background(), predictParams{Document: name, Text: "x"}); rpcErr != nil {
+			t.Fatalf("predict %s error = %v", name, rpcErr)
+		}
+	}
+	// Opening c closes b, the least recently used document
+	for name, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if open := s.lookup(name) != nil; open != want {
+			t.Errorf("document %s open = %v, want %v", name, open, want)
+		}
+	}
+}
@@ -2,4 +2,6 @@ module github.com/jsnanigans/copre
 
 go 1.24.2
 
-require github.com/sergi/go-diff v1.3.1 // indirect
+require github.com/sergi/go-diff v1.3.1
+
+require github.com/google/go-cmp v0.7.0
@@ -1,8 +1,8 @@
 package copre
 
 import (
-	"log"
 	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -105,44 +105,121 @@ func getLocalContext(text string, pos int, length int) (prefix string, affix str
 	return prefix, affix
 }
 
+// commonSuffixLen returns the byte length of the longest common suffix of a and b,
+// only counting whole runes so multi-byte characters never match partially.
+func commonSuffixLen(a, b string) int {
+	n := 0
+	for len(a) > n && len(b) > n {
+		ra, sizeA := utf8.DecodeLastRuneInString(a[:len(a)-n])
+		rb, sizeB := utf8.DecodeLastRuneInString(b[:len(b)-n])
+		if ra != rb || sizeA != sizeB {
+			break
+		}
+		n += sizeA
+	}
+	return n
+}
+
+// commonPrefixLen returns the byte length of the longest common prefix of a and b,
+// only counting whole runes so multi-byte characters never match partially.
+func commonPrefixLen(a, b string) int {
+	n := 0
+	for len(a) > n && len(b) > n {
+		ra, sizeA := utf8.DecodeRuneInString(a[n:])
+		rb, sizeB := utf8.DecodeRuneInString(b[n:])
+		if ra != rb || sizeA != sizeB {
+			break
+		}
+		n += sizeA
+	}
+	return n
+}
+
+// isIdentRune reports whether r can be part of an identifier-like word.
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// leadingToken returns the token at the very start of s: a run of identifier
+// runes, a single punctuation rune, or leading whitespace followed by the next token.
+func leadingToken(s string) string {
+	if s == "" {
+		return ""
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	switch {
+	case unicode.IsSpace(r):
+		end := len(s) - len(strings.TrimLeftFunc(s, unicode.IsSpace))
+		return s[:end] + leadingToken(s[end:])
+	case isIdentRune(r):
+		end := strings.IndexFunc(s, func(r rune) bool { return !isIdentRune(r) })
+		if end == -1 {
+			return s
+		}
+		return s[:end]
+	default:
+		return s[:size]
+	}
+}
+
+// trailingToken is the mirror image of leadingToken for the end of s.
+func trailingToken(s string) string {
+	if s == "" {
+		return ""
+	}
+	r, size := utf8.DecodeLastRuneInString(s)
+	switch {
+	case unicode.IsSpace(r):
+		start := len(strings.TrimRightFunc(s, unicode.IsSpace))
+		return trailingToken(s[:start]) + s[start:]
+	case isIdentRune(r):
+		start := strings.LastIndexFunc(s, func(r rune) bool { return !isIdentRune(r) })
+		if start == -1 {
+			return s
+		}
+		_, width := utf8.DecodeRuneInString(s[start:])
+		return s[start+width:]
+	default:
+		return s[len(s)-size:]
+	}
+}
+
+// baseScore is the score of a candidate that matches the changed text but none of its
+// context.
+const baseScore = 5
+
 // findAndScoreAnchors searches for potential prediction anchor points in the original text
-// based on the text that was changed (removed or added).
-func findAndScoreAnchors(oldText, charsAdded, charsRemoved string, originalChangeStartPos int) []Anchor {
-	var anchors []Anchor
-	// TODO: Decide how to use charsAdded in anchor finding/scoring.
-	// For now, primarily using charsRemoved for anchor identification.
-	searchText := charsRemoved // Or potentially combine/choose between added/removed
+// based on the text that was changed (removed or added), scoring each with cfg.scorer.
+// With cfg.CaseInsensitive, occurrences of the removed text differing in case count.
+func findAndScoreAnchors(oldText, charsAdded, charsRemoved string, originalChangeStartPos int, cfg config) []Anchor {
+	anchors := []Anchor{}
+	searchText := charsRemoved
 	if searchText == "" {
-		// If nothing was removed (pure insertion), maybe use charsAdded?
-		// Or maybe anchor finding doesn't make sense for pure insertions?
-		// For now, return no anchors if nothing was removed.
-		// searchText = charsAdded // Example if we decide to search based on added text
 		if charsAdded == "" {
-			log.Printf("DEBUG: No text added or removed, cannot find anchors.")
 			return anchors // Nothing to search for
-		} else {
-			// TODO: Implement anchor finding logic based *only* on added text if needed.
-			log.Printf("DEBUG: Only text added, anchor finding based on added text not yet implemented.")
-			return anchors
 		}
+		// Pure insertion: there is no removed text to look for, so anchor on the
+		// context surrounding the insertion point instead.
+		return findInsertionAnchors(oldText, originalChangeStartPos, cfg)
 	}
 
 	if len(searchText) == 0 || originalChangeStartPos == -1 {
 		return anchors
 	}
 
-	// Get the context around the original change
-	originalPrefix, originalAffix := getLocalContext(oldText, originalChangeStartPos, len(searchText))
-	log.Printf("DEBUG: Original Context - Prefix: %q, Affix: %q", originalPrefix, originalAffix)
-
 	startPosOutOfBounds := originalChangeStartPos < 0 || originalChangeStartPos > len(oldText)
 	if startPosOutOfBounds {
 		return anchors
 	}
 
+	// Get the context around the original change
+	sites := newSiteText(oldText)
+	original := sites.site(originalChangeStartPos, len(searchText))
+	cfg.logger.Debug("original context", "stage", "anchors", "pos", original.Position, "prefix", original.Prefix, "affix", original.Affix)
+
 	searchStart := 0
-	for {
-		foundPos := strings.Index(oldText[searchStart:], searchText)
+	for !cfg.done() {
+		foundPos := indexFold(oldText[searchStart:], searchText, cfg.CaseInsensitive)
 		if foundPos == -1 {
 			break // No more occurrences
 		}
@@ -158,46 +235,116 @@ func findAndScoreAnchors(oldText, charsAdded, charsRemoved string, originalChang
 			continue
 		}
 
-		// Calculate line number for the anchor
-		anchorLine := 1 + strings.Count(oldText[:anchorPos], "\n")
+		// Get the context for this potential anchor and score it against the original
+		candidate := sites.site(anchorPos, len(searchText))
+		score := cfg.scorer.Score(original, candidate)
+		cfg.trace.addCandidate("exact", candidate, score)
 
-		// Get the local context for this potential anchor
-		anchorPrefix, anchorAffix := getLocalContext(oldText, anchorPos, len(searchText))
+		anchors = append(anchors, Anchor{Position: anchorPos, Score: score.Total, Line: candidate.Line})
 
-		// Initialize anchor with base score
-		baseScore := 5 // Base score for matching removed text
-		score := baseScore
+		// Move search start past the current find
+		searchStart = anchorPos + 1
+		if searchStart >= len(oldText) {
+			break
+		}
+	}
+	cfg.logger.Debug("found anchors", "stage", "anchors", "search", searchText, "count", len(anchors))
+	return anchors
+}
 
-		// Score based on prefix matching (compare anchor's prefix with original's prefix)
-		prefixMatchLen := 0
-		for i := 1; i <= len(originalPrefix) && i <= len(anchorPrefix); i++ {
-			if originalPrefix[len(originalPrefix)-i:] == anchorPrefix[len(anchorPrefix)-i:] {
-				prefixMatchLen = i
-			} else {
-				break
-			}
+// findInsertionAnchors finds positions in oldText that are analogous to the insertion
+// point at originalChangeStartPos. A candidate must be surrounded by the same tokens as
+// the original insertion point (e.g. the same word before it and the same punctuation
+// after it); candidates are then scored with cfg.scorer.
+func findInsertionAnchors(oldText string, originalChangeStartPos int, cfg config) []Anchor {
+	anchors := []Anchor{}
+	if originalChangeStartPos < 0 || originalChangeStartPos > len(oldText) {
+		return anchors
+	}
+
+	sites := newSiteText(oldText)
+	original := sites.site(originalChangeStartPos, 0)
+	before, after := trailingToken(original.Prefix), leadingToken(original.Affix)
+	cfg.logger.Debug("insertion context", "stage", "anchors", "pos", original.Position, "before", before, "after", after)
+	if before == "" && after == "" {
+		return anchors // The insertion point has no surrounding context to look for
+	}
+
+	searchText := before + after
+	searchStart := 0
+	for searchStart <= len(oldText) && !cfg.done() {
+		foundPos := strings.Index(oldText[searchStart:], searchText)
+		if foundPos == -1 {
+			break
 		}
-		score += prefixMatchLen
+		anchorPos := searchStart + foundPos + len(before) // The insertion point sits between the two tokens
+		searchStart += foundPos + 1
 
-		// Score based on affix matching (compare anchor's affix with original's affix)
-		affixMatchLen := 0
-		for i := 1; i <= len(originalAffix) && i <= len(anchorAffix); i++ {
-			if originalAffix[:i] == anchorAffix[:i] {
-				affixMatchLen = i
-			} else {
-				break
-			}
+		if anchorPos == originalChangeStartPos {
+			continue
 		}
-		score += affixMatchLen
 
-		anchors = append(anchors, Anchor{Position: anchorPos, Score: score, Line: anchorLine})
+		// The tokens must match as whole tokens, so "two|" does not match inside "network|".
+		candidate := sites.site(anchorPos, 0)
+		if trailingToken(candidate.Prefix) != before || leadingToken(candidate.Affix) != after {
+			cfg.trace.rejectCandidate("insertion", candidate, func() Score { return cfg.scorer.Score(original, candidate) }, reasonTokensDiffer)
+			continue
+		}
 
-		// Move search start past the current find
-		searchStart = anchorPos + 1
-		if searchStart >= len(oldText) {
-			break
+		score := cfg.scorer.Score(original, candidate)
+		cfg.trace.addCandidate("insertion", candidate, score)
+		anchors = append(anchors, Anchor{Position: anchorPos, Score: score.Total, Line: candidate.Line})
+	}
+	cfg.logger.Debug("found insertion anchors", "stage", "anchors", "count", len(anchors))
+	return anchors
+}
+
+// repeatedEditBonus is added to an anchor's score for every additional time the user
+// has already made the same edit, since repetition is strong evidence of the pattern.
+const repeatedEditBonus = 2
+
+// findAnchorsForEdits finds anchors for a group of identical edits. Each edit in the group
+// is an example of the change the user is repeating: an anchor is scored against the
+// example whose context it matches best, reinforced by the number of examples, and the
+// positions of all examples are excluded since those edits have already been made.
+func findAnchorsForEdits(oldText string, group []Edit, cfg config) []Anchor {
+	anchors := []Anchor{}
+	if len(group) == 0 {
+		return anchors
+	}
+
+	edited := make(map[int]bool, len(group))
+	for _, e := range group {
+		edited[e.OldPos] = true
+	}
+
+	source := "exact"
+	if group[0].Removed == "" {
+		source = "insertion"
+	}
+	best := make(map[int]int) // Anchor position -> index into anchors
+	for _, e := range group {
+		for _, anchor := range findAndScoreAnchors(oldText, e.Added, e.Removed, e.OldPos, cfg) {
+			if edited[anchor.Position] {
+				cfg.trace.reject(anchor.Position, reasonAlreadyEdited, source)
+				continue
+			}
+			if i, ok := best[anchor.Position]; ok {
+				if anchor.Score > anchors[i].Score {
+					anchors[i] = anchor
+				}
+				continue
+			}
+			best[anchor.Position] = len(anchors)
+			anchors = append(anchors, anchor)
 		}
 	}
-	log.Printf("DEBUG: Found Anchors (using local context): %+v", anchors)
+
+	bonus := repeatedEditBonus * (len(group) - 1)
+	for i := range anchors {
+		anchors[i].Score += bonus
+		cfg.trace.addPoints(source, anchors[i].Position, "repetition", bonus)
+	}
+	cfg.logger.Debug("scored anchors", "stage", "anchors", "edits", len(group), "count", len(anchors))
 	return anchors
 }
@@ -178,8 +178,8 @@ func TestFindAndScoreAnchors(t *testing.T) {
 			charsAdded:             "",           // ADDED
 			originalChangeStartPos: 0,
 			wantAnchors: []Anchor{
-				{Position: 0, Score: 12, Line: 1},
-				{Position: 12, Score: 12, Line: 2},
+				// Original context: prefix="", affix="here"; anchor: prefix="", affix="there"
+				{Position: 15, Score: 5, Line: 2},
 			},
 		},
 		{
@@ -189,8 +189,8 @@ func TestFindAndScoreAnchors(t *testing.T) {
 			charsAdded:             "",           // ADDED
 			originalChangeStartPos: 7,            // After "prefix "
 			wantAnchors: []Anchor{
-				{Position: 7, Score: 12, Line: 1},
-				{Position: 19, Score: 12, Line: 2},
+				// Prefix "prefix " matches (7), affixes "here suffix"/"there suffix" differ at once
+				{Position: 36, Score: 12, Line: 2},
 			},
 		},
 		{
@@ -232,8 +232,9 @@ func TestFindAndScoreAnchors(t *testing.T) {
 			charsAdded:             "",    // ADDED
 			originalChangeStartPos: 0,
 			wantAnchors: []Anchor{
-				{Position: 0, Score: 5, Line: 1},
-				{Position: 5, Score: 5, Line: 2},
+				// "你好 世界" is 13 bytes, so line 2 starts at byte 14.
+				// Affixes "世界"/"中国" share leading bytes but no whole rune.
+				{Position: 14, Score: 5, Line: 2},
 			},
 		},
 		{
@@ -243,8 +244,8 @@ func TestFindAndScoreAnchors(t *testing.T) {
 			charsAdded:             "",           // ADDED
 			originalChangeStartPos: 4,            // After "abc "
 			wantAnchors: []Anchor{
-				{Position: 4, Score: 8, Line: 1},
-				{Position: 12, Score: 8, Line: 2},
+				// Prefixes "abc "/"xyz " share the trailing space
+				{Position: 22, Score: 6, Line: 2},
 			},
 		},
 		{
@@ -256,18 +257,43 @@ func TestFindAndScoreAnchors(t *testing.T) {
 			wantAnchors:            []Anchor{}, // Local context prevents matching 'delete me' on line 3
 		},
 		{
-			name:                   "Pure insertion - no anchors expected (currently)",
+			name:                   "Pure insertion - no analogous insertion point",
 			oldText:                "line1\nline3",
 			searchText:             "",         // Represents charsRemoved
 			charsAdded:             "\nline2",  // ADDED - This is what was inserted
 			originalChangeStartPos: 5,          // Position where insertion happened
-			wantAnchors:            []Anchor{}, // Current logic doesn't find anchors based on added text
+			wantAnchors:            []Anchor{}, // "line1" at the end of a line does not occur elsewhere
+		},
+		{
+			name: "Pure insertion - same surrounding tokens",
+			// Original insertion of ", ctx" between "a" and ")" at pos 5.
+			oldText:                "foo(a)\nbar(a)\nfoo(b)\nbaz(aa)",
+			searchText:             "",
+			charsAdded:             ", ctx",
+			originalChangeStartPos: 5,
+			wantAnchors: []Anchor{
+				// Prefix "bar(a" shares "(a" with "foo(a", affix ")" matches
+				{Position: 12, Score: 5 + 2 + 1, Line: 2},
+				// "foo(b)" and "baz(aa)" are not surrounded by the tokens "a" and ")"
+			},
+		},
+		{
+			name: "Pure insertion - at line end",
+			// Original insertion of ";" at the end of line 1.
+			oldText:                "x := 1\ny := 1\nz := 1 + 1\nw := 2",
+			searchText:             "",
+			charsAdded:             ";",
+			originalChangeStartPos: 6,
+			wantAnchors: []Anchor{
+				{Position: 13, Score: 5 + 5, Line: 2}, // " := 1" matches
+				{Position: 24, Score: 5 + 2, Line: 3}, // " 1" matches, "+ 1" does not
+			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotAnchors := findAndScoreAnchors(tt.oldText, tt.charsAdded, tt.searchText /*charsRemoved*/, tt.originalChangeStartPos)
+			gotAnchors := findAndScoreAnchors(tt.oldText, tt.charsAdded, tt.searchText /*charsRemoved*/, tt.originalChangeStartPos, newConfig(Options{}))
 			sortAnchors(gotAnchors)
 			sortAnchors(tt.wantAnchors) // Sort expected anchors too for consistent comparison
 			var bothEmpty = len(gotAnchors) == 0 && len(tt.wantAnchors) == 0
@@ -395,7 +421,7 @@ func TestGetLocalContext(t *testing.T) {
 		{
 			name:       "Unicode end of line",
 			text:       "line1\n你好 世界", // line1\nHello World
-			pos:        12,             // start of 世界
+			pos:        13,             // start of 世界
 			length:     6,              // byte length of 世界
 			wantPrefix: "你好 ",
 			wantAffix:  "",
@@ -445,7 +471,7 @@ func TestFindAndScoreAnchors_LocalContext(t *testing.T) {
 			wantAnchors: []Anchor{
 				// Original context: prefix="prefix ", affix="here suffix"
 				// Anchor context: prefix="prefix ", affix="there suffix"
-				{Position: 34, Score: 5 /*base*/ + 7 /*prefix*/ + 5 /*affix match ' suff'*/, Line: 2}, // Corrected score
+				{Position: 36, Score: 5 /*base*/ + 7 /*prefix*/ + 0 /*affix*/, Line: 2},
 			},
 		},
 		{
@@ -489,7 +515,7 @@ func TestFindAndScoreAnchors_LocalContext(t *testing.T) {
 			wantAnchors: []Anchor{
 				// Original context: prefix="", affix="世界"
 				// Anchor context: prefix="", affix="中国"
-				{Position: 10, Score: 5 /*base*/ + 0 /*prefix*/ + 0 /*affix*/, Line: 2},
+				{Position: 14, Score: 5 /*base*/ + 0 /*prefix*/ + 0 /*affix*/, Line: 2},
 			},
 		},
 		{
@@ -514,19 +540,19 @@ func TestFindAndScoreAnchors_LocalContext(t *testing.T) {
 		},
 		{
 			// Test case simulating pure insertion (charsRemoved is empty)
-			name:                   "Pure insertion - no anchors expected (currently)",
+			name:                   "Pure insertion - no analogous insertion point",
 			oldText:                "line1\nline3",
 			searchText:             "",         // Represents charsRemoved = empty
 			charsAdded:             "\nline2",  // ADDED: This is what was inserted
 			originalChangeStartPos: 5,          // Position where insertion happened
-			wantAnchors:            []Anchor{}, // Current logic returns empty if searchText is empty
+			wantAnchors:            []Anchor{}, // No other line ends with the token "line1"
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			// Pass tt.charsAdded to the function call
-			gotAnchors := findAndScoreAnchors(tt.oldText, tt.charsAdded, tt.searchText /*charsRemoved*/, tt.originalChangeStartPos)
+			gotAnchors := findAndScoreAnchors(tt.oldText, tt.charsAdded, tt.searchText /*charsRemoved*/, tt.originalChangeStartPos, newConfig(Options{}))
 
 			// Custom comparison logic for slices of Anchors
 			sortAnchors(gotAnchors)     // Sort actual anchors
@@ -538,3 +564,54 @@ func TestFindAndScoreAnchors_LocalContext(t *testing.T) {
 		})
 	}
 }
+
+func TestFindAnchorsForEdits(t *testing.T) {
+	tests := []struct {
+		name        string
+		oldText     string
+		group       []Edit
+		wantAnchors []Anchor
+	}{
+		{
+			name:        "No edits",
+			oldText:     "abc",
+			group:       nil,
+			wantAnchors: []Anchor{},
+		},
+		{
+			name:    "Single edit behaves like findAndScoreAnchors",
+			oldText: "a-x\nb-x",
+			group:   []Edit{{OldPos: 1, Removed: "-x"}},
+			wantAnchors: []Anchor{
+				{Position: 5, Score: 5, Line: 2},
+			},
+		},
+		{
+			name:    "Repeated edits are excluded and reinforce the score",
+			oldText: "a-x\nb-x\nc-x",
+			group:   []Edit{{OldPos: 1, Removed: "-x"}, {OldPos: 5, Removed: "-x"}},
+			wantAnchors: []Anchor{
+				{Position: 9, Score: 5 + repeatedEditBonus, Line: 3},
+			},
+		},
+		{
+			name: "Anchor scored against the best matching example",
+			// Line 3 shares the prefix "foo " with the second example only.
+			oldText: "bar -x\nfoo -x\nfoo -x",
+			group:   []Edit{{OldPos: 4, Removed: "-x"}, {OldPos: 11, Removed: "-x"}},
+			wantAnchors: []Anchor{
+				{Position: 18, Score: 5 + 4 + repeatedEditBonus, Line: 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotAnchors := findAnchorsForEdits(tt.oldText, tt.group, newConfig(Options{}))
+			sortAnchors(gotAnchors)
+			if diff := cmp.Diff(tt.wantAnchors, gotAnchors); diff != "" {
+				t.Errorf("findAnchorsForEdits() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package copre
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// ApplyResult is the outcome of ApplyPredictions.
+type ApplyResult struct {
+	Text      string              `json:"text"`    // The text with the applied predictions carried out
+	Applied   []PredictedChange   `json:"applied"` // The applied predictions, ordered by MappedPosition
+	Skipped   []SkippedPrediction `json:"skipped"` // The predictions that were not applied, in the order given
+	Positions PositionMap         `json:"-"`       // Maps offsets in the original text to offsets in Text
+}
+
+// SkippedPrediction is a prediction ApplyPredictions did not apply, and why.
+type SkippedPrediction struct {
+	Prediction PredictedChange `json:"prediction"`
+	Reason     string          `json:"reason"`
+}
+
+// PositionMap maps byte offsets in a text to the corresponding offsets in an edited
+// version of it.
+type PositionMap struct {
+	diffs []diffmatchpatch.Diff
+}
+
+// Map returns the offset in the edited text corresponding to pos. A position inside
+// removed text maps to where the removal took place.
+func (m PositionMap) Map(pos int) int {
+	return mapPosition(pos, m.diffs)
+}
+
+// ApplyPredictions applies predictions to newText, the text their MappedPosition refers
+// to, in one pass. Predictions are accepted in the order given, so on a conflict the
+// earlier one wins: a prediction is skipped if it is out of bounds, if the text it
+// removes is not at its MappedPosition, if it changes nothing, or if it overlaps a
+// prediction already accepted (an insertion overlaps a change whose range contains its
+// insertion point).
+func ApplyPredictions(newText string, predictions []PredictedChange) ApplyResult {
+	result := ApplyResult{Applied: []PredictedChange{}, Skipped: []SkippedPrediction{}}
+	for _, p := range predictions {
+		if reason := applyConflict(newText, p, result.Applied); reason != "" {
+			result.Skipped = append(result.Skipped, SkippedPrediction{Prediction: p, Reason: reason})
+			continue
+		}
+		result.Applied = append(result.Applied, p)
+	}
+	sort.SliceStable(result.Applied, func(i, j int) bool {
+		return result.Applied[i].MappedPosition < result.Applied[j].MappedPosition
+	})
+
+	// Describe the result as diffs of newText, which gives both the text and the map
+	var diffs []diffmatchpatch.Diff
+	last := 0
+	for _, p := range result.Applied {
+		end := p.MappedPosition + len(p.TextToRemove)
+		diffs = appendDiff(diffs, diffmatchpatch.DiffEqual, newText[last:p.MappedPosition])
+		diffs = appendDiff(diffs, diffmatchpatch.DiffDelete, p.TextToRemove)
+		diffs = appendDiff(diffs, diffmatchpatch.DiffInsert, p.TextToAdd)
+		last = end
+	}
+	diffs = appendDiff(diffs, diffmatchpatch.DiffEqual, newText[last:])
+	result.Text = diffmatchpatch.New().DiffText2(diffs)
+	result.Positions = PositionMap{diffs: diffs}
+	return result
+}
+
+// applyConflict returns why p cannot be applied to text alongside the accepted
+// predictions, or "" if it can.
+func applyConflict(text string, p PredictedChange, accepted []PredictedChange) string {
+	end := p.MappedPosition + len(p.TextToRemove)
+	switch {
+	case p.TextToRemove == "" && p.TextToAdd == "":
+		return "nothing to change"
+	case p.MappedPosition < 0 || end > len(text):
+		return fmt.Sprintf("out of bounds (text length %d)", len(text))
+	case text[p.MappedPosition:end] != p.TextToRemove:
+		return fmt.Sprintf("expects %q but text has %q", p.TextToRemove, text[p.MappedPosition:end])
+	}
+	for _, a := range accepted {
+		if predictionsOverlap(p, a) {
+			return fmt.Sprintf("overlaps the prediction at %d", a.MappedPosition)
+		}
+	}
+	return ""
+}
+
+// appendDiff appends a diff of the given type and text, omitting empty ones and merging
+// it into the last diff if that has the same type.
+func appendDiff(diffs []diffmatchpatch.Diff, op diffmatchpatch.Operation, text string) []diffmatchpatch.Diff {
+	if text == "" {
+		return diffs
+	}
+	if n := len(diffs); n > 0 && diffs[n-1].Type == op {
+		diffs[n-1].Text += text
+		return diffs
+	}
+	return append(diffs, diffmatchpatch.Diff{Type: op, Text: text})
+}
@@ -0,0 +1,101 @@
+package copre
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyPredictions(t *testing.T) {
+	replace := func(pos int, remove, add string) PredictedChange {
+		return PredictedChange{TextToRemove: remove, TextToAdd: add, MappedPosition: pos}
+	}
+
+	tests := []struct {
+		name        string
+		text        string
+		predictions []PredictedChange
+		wantText    string
+		wantApplied []PredictedChange
+		wantSkipped []SkippedPrediction
+	}{
+		{
+			name:        "No predictions",
+			text:        "hello world",
+			predictions: []PredictedChange{},
+			wantText:    "hello world",
+			wantApplied: []PredictedChange{},
+			wantSkipped: []SkippedPrediction{},
+		},
+		{
+			name:        "Replacement, deletion and insertion in any order",
+			text:        "a.x b.x c",
+			predictions: []PredictedChange{replace(9, "", ";"), replace(1, ".x", ""), replace(4, "b", "bb")},
+			wantText:    "a bb.x c;",
+			wantApplied: []PredictedChange{replace(1, ".x", ""), replace(4, "b", "bb"), replace(9, "", ";")},
+			wantSkipped: []SkippedPrediction{},
+		},
+		{
+			name:        "Adjacent replacements",
+			text:        "ab",
+			predictions: []PredictedChange{replace(0, "a", "x"), replace(1, "b", "y")},
+			wantText:    "xy",
+			wantApplied: []PredictedChange{replace(0, "a", "x"), replace(1, "b", "y")},
+			wantSkipped: []SkippedPrediction{},
+		},
+		{
+			name: "Skipped predictions",
+			text: "foo bar",
+			predictions: []PredictedChange{
+				replace(0, "foo", "baz"),
+				replace(1, "oo", "x"),
+				replace(3, "", "!"),
+				replace(4, "baz", ""),
+				replace(6, "rr", ""),
+				replace(-1, "", "x"),
+				replace(2, "", ""),
+			},
+			wantText:    "baz bar",
+			wantApplied: []PredictedChange{replace(0, "foo", "baz")},
+			wantSkipped: []SkippedPrediction{
+				{replace(1, "oo", "x"), "overlaps the prediction at 0"},
+				{replace(3, "", "!"), "overlaps the prediction at 0"},
+				{replace(4, "baz", ""), `expects "baz" but text has "bar"`},
+				{replace(6, "rr", ""), "out of bounds (text length 7)"},
+				{replace(-1, "", "x"), "out of bounds (text length 7)"},
+				{replace(2, "", ""), "nothing to change"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ApplyPredictions(tt.text, tt.predictions)
+			if got.Text != tt.wantText {
+				t.Errorf("ApplyPredictions().Text = %q, want %q", got.Text, tt.wantText)
+			}
+			if !reflect.DeepEqual(got.Applied, tt.wantApplied) {
+				t.Errorf("ApplyPredictions().Applied = %+v, want %+v", got.Applied, tt.wantApplied)
+			}
+			if !reflect.DeepEqual(got.Skipped, tt.wantSkipped) {
+				t.Errorf("ApplyPredictions().Skipped = %+v, want %+v", got.Skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestApplyPredictionsPositions(t *testing.T) {
+	// "one two three" -> "1 two three!": offsets after "one" shift back by two, offsets
+	// inside it map to where it was replaced.
+	result := ApplyPredictions("one two three", []PredictedChange{
+		{TextToRemove: "one", TextToAdd: "1", MappedPosition: 0},
+		{TextToAdd: "!", MappedPosition: 13},
+	})
+	if result.Text != "1 two three!" {
+		t.Fatalf("ApplyPredictions().Text = %q", result.Text)
+	}
+	for pos, want := range map[int]int{0: 0, 1: 0, 3: 1, 4: 2, 8: 6, 13: 12} {
+		if got := result.Positions.Map(pos); got != want {
+			t.Errorf("Positions.Map(%d) = %d, want %d", pos, got, want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package copre
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// caseStyle formats a list of lower-case words in one identifier naming convention.
+type caseStyle func(words []string) string
+
+// caseStyles are the naming conventions case-preserving prediction looks for:
+// camelCase, PascalCase, snake_case, SCREAMING_SNAKE_CASE and kebab-case.
+var caseStyles = []caseStyle{
+	func(words []string) string { return strings.Join(titleWords(words, 1), "") },
+	func(words []string) string { return strings.Join(titleWords(words, 0), "") },
+	func(words []string) string { return strings.Join(words, "_") },
+	func(words []string) string { return strings.ToUpper(strings.Join(words, "_")) },
+	func(words []string) string { return strings.Join(words, "-") },
+}
+
+// titleWords returns a copy of words with every word from index `from` on capitalized.
+func titleWords(words []string, from int) []string {
+	titled := make([]string, len(words))
+	for i, w := range words {
+		if i >= from && w != "" {
+			r, size := utf8.DecodeRuneInString(w)
+			w = string(unicode.ToUpper(r)) + w[size:]
+		}
+		titled[i] = w
+	}
+	return titled
+}
+
+// splitWords splits an identifier written in any of the caseStyles into lower-case
+// words: "userId", "UserID", "user_id" and "user-id" all give [user id]. It returns
+// nil if s contains anything other than letters, digits, '_' and '-'.
+func splitWords(s string) []string {
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, strings.ToLower(string(current)))
+			current = current[:0]
+		}
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-':
+			flush()
+		case unicode.IsUpper(r):
+			// A new word starts at an upper-case letter after a lower-case one or a digit
+			// ("userId"), or at the last capital of an acronym followed by a lower-case
+			// letter ("HTTPServer" -> HTTP, Server).
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				flush()
+			}
+			current = append(current, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			current = append(current, r)
+		default:
+			return nil
+		}
+	}
+	flush()
+	return words
+}
+
+// caseVariants returns the (from, to) pairs of from and to written in every case style,
+// except the pair as it was written originally and styles that give the same text.
+func caseVariants(from, to string) [][2]string {
+	fromWords, toWords := splitWords(from), splitWords(to)
+	if len(fromWords) == 0 || len(toWords) == 0 {
+		return nil
+	}
+	seen := map[string]bool{from: true}
+	var variants [][2]string
+	for _, style := range caseStyles {
+		f := style(fromWords)
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		variants = append(variants, [2]string{f, style(toWords)})
+	}
+	return variants
+}
+
+// findTokenAnchors finds the whole-token occurrences of searchText in oldText. Each
+// occurrence is scored against the edit in group whose context it matches best and
+// reinforced by the number of edits, like findAnchorsForEdits; positions touched by any
+// edit in group are skipped. Unlike findAndScoreAnchors, occurrences inside longer
+// identifiers are not anchors.
+func findTokenAnchors(oldText, searchText string, group []Edit, cfg config) []Anchor {
+	anchors := []Anchor{}
+	if len(group) == 0 || searchText == "" {
+		return anchors
+	}
+
+	sites := newSiteText(oldText)
+	originals := make([]Site, len(group))
+	for i, e := range group {
+		originals[i] = sites.site(e.OldPos, len(e.Removed))
+	}
+
+	for searchStart := 0; searchStart < len(oldText) && !cfg.done(); {
+		foundPos := indexFold(oldText[searchStart:], searchText, cfg.CaseInsensitive)
+		if foundPos == -1 {
+			break
+		}
+		anchorPos := searchStart + foundPos
+		searchStart = anchorPos + len(searchText)
+
+		candidate := sites.site(anchorPos, len(searchText))
+		score := func() Score {
+			s := bestScore(cfg.scorer, originals, candidate)
+			if bonus := repeatedEditBonus * (len(group) - 1); bonus > 0 {
+				s.Total += bonus
+				s.Breakdown = append(s.Breakdown, ScoreComponent{Name: "repetition", Points: bonus})
+			}
+			return s
+		}
+		if overlapsEdits(anchorPos, anchorPos+len(searchText), group) {
+			cfg.trace.rejectCandidate("identifier", candidate, score, reasonAlreadyEdited)
+			continue
+		}
+		if !isWholeToken(oldText, anchorPos, anchorPos+len(searchText)) {
+			cfg.trace.rejectCandidate("identifier", candidate, score, reasonPartialToken)
+			continue
+		}
+		s := score()
+		cfg.trace.addCandidate("identifier", candidate, s)
+		anchors = append(anchors, Anchor{Position: anchorPos, Score: s.Total, Line: candidate.Line})
+	}
+	cfg.logger.Debug("found token anchors", "stage", "anchors", "search", searchText, "count", len(anchors))
+	return anchors
+}
+
+// generateCaseVariantPredictions predicts replacing each case variant of from (e.g.
+// USER_ID for userId) with the same variant of to (ACCOUNT_ID for accountId).
+func generateCaseVariantPredictions(oldText, newText, from, to string, group []Edit, diffs []diffmatchpatch.Diff, cfg config) []PredictedChange {
+	predictions := []PredictedChange{}
+	for _, variant := range caseVariants(from, to) {
+		anchors := findTokenAnchors(oldText, variant[0], group, cfg)
+		predictions = append(predictions, generatePredictions(newText, anchors, variant[1], variant[0], diffs, cfg)...)
+	}
+	cfg.logger.Debug("generated case variant predictions", "stage", "predictions", "count", len(predictions))
+	return predictions
+}
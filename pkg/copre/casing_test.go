@@ -0,0 +1,119 @@
+package copre
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "userId", want: []string{"user", "id"}},
+		{in: "UserId", want: []string{"user", "id"}},
+		{in: "user_id", want: []string{"user", "id"}},
+		{in: "USER_ID", want: []string{"user", "id"}},
+		{in: "user-id", want: []string{"user", "id"}},
+		{in: "HTTPServer", want: []string{"http", "server"}},
+		{in: "parseV2Config", want: []string{"parse", "v2", "config"}},
+		{in: "user", want: []string{"user"}},
+		{in: "user id", want: nil},
+		{in: "a.b", want: nil},
+	}
+	for _, tt := range tests {
+		if got := splitWords(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitWords(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCaseVariants(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     [][2]string
+	}{
+		{
+			from: "userId", to: "accountId",
+			want: [][2]string{
+				{"UserId", "AccountId"},
+				{"user_id", "account_id"},
+				{"USER_ID", "ACCOUNT_ID"},
+				{"user-id", "account-id"},
+			},
+		},
+		{
+			// Single words only have three distinct spellings
+			from: "user", to: "account",
+			want: [][2]string{
+				{"User", "Account"},
+				{"USER", "ACCOUNT"},
+			},
+		},
+		{from: "a b", to: "c", want: nil},
+	}
+	for _, tt := range tests {
+		if got := caseVariants(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("caseVariants(%q, %q) = %q, want %q", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestPredictCasePreserving(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		want    []PredictedChange
+	}{
+		{
+			name: "Rename in every naming convention",
+			oldText: "userId := 1\n" +
+				"type UserId int\n" +
+				"const USER_ID = \"user_id\"\n" +
+				"url := \"/user-id\"",
+			newText: "accountId := 1\n" +
+				"type UserId int\n" +
+				"const USER_ID = \"user_id\"\n" +
+				"url := \"/user-id\"",
+			want: []PredictedChange{
+				// Score: 5 (base) + 1 (affix " ")
+				{Position: 17, TextToRemove: "UserId", TextToAdd: "AccountId", Line: 2, Score: 6, MappedPosition: 20},
+				{Position: 34, TextToRemove: "USER_ID", TextToAdd: "ACCOUNT_ID", Line: 3, Score: 6, MappedPosition: 37},
+				{Position: 45, TextToRemove: "user_id", TextToAdd: "account_id", Line: 3, Score: 5, MappedPosition: 48},
+				{Position: 63, TextToRemove: "user-id", TextToAdd: "account-id", Line: 4, Score: 5, MappedPosition: 66},
+			},
+		},
+		{
+			name:    "Variants inside longer identifiers are skipped",
+			oldText: "user := 1\nUser(SuperUSER, USER)",
+			newText: "account := 1\nUser(SuperUSER, USER)",
+			want: []PredictedChange{
+				{Position: 10, TextToRemove: "User", TextToAdd: "Account", Line: 2, Score: 5, MappedPosition: 13},
+				{Position: 26, TextToRemove: "USER", TextToAdd: "ACCOUNT", Line: 2, Score: 5, MappedPosition: 29},
+			},
+		},
+		{
+			name:    "Exact occurrences are still predicted",
+			oldText: "maxSize(a)\nmaxSize(b)\nMAX_SIZE",
+			newText: "minSize(a)\nmaxSize(b)\nMAX_SIZE",
+			want: []PredictedChange{
+				{Position: 11, TextToRemove: "maxSize", TextToAdd: "minSize", Line: 2, Score: 6, MappedPosition: 11},
+				{Position: 22, TextToRemove: "MAX_SIZE", TextToAdd: "MIN_SIZE", Line: 3, Score: 5, MappedPosition: 22},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PredictCasePreserving(tt.oldText, tt.newText)
+			if err != nil {
+				t.Fatalf("PredictCasePreserving() error = %v", err)
+			}
+			sortPredictions(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PredictCasePreserving() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,40 +1,198 @@
 package copre
 
 import (
-	"log"
-	// "sort"
-	// "strings"
+	"context"
+	"slices"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
 // PredictNextChanges analyzes the differences between oldText and newText
-// to predict the next likely changes (currently focusing on deletions).
+// to predict the next likely changes (repeated deletions, insertions and replacements).
+// It is PredictWithOptions with the default Options.
 func PredictNextChanges(oldText, newText string) ([]PredictedChange, error) {
-	log.Printf("DEBUG: oldText:\n%s", oldText)
-	log.Printf("DEBUG: newText:\n%s", newText)
+	return PredictWithOptions(context.Background(), oldText, newText, Options{})
+}
+
+// PredictWithOptions is PredictNextChanges configured by opts. It returns ctx's error if
+// ctx is already done. If ctx is done or opts.Timeout passes while predicting, it returns
+// the predictions found so far and an error wrapping ErrTruncated and ctx's error.
+func PredictWithOptions(ctx context.Context, oldText, newText string, opts Options) ([]PredictedChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cfg, cancel := startConfig(ctx, opts)
+	defer cancel()
+	cfg.logger.Debug("predicting", "stage", "input", "oldLen", len(oldText), "newLen", len(newText))
+	result := predict(oldText, newText, cfg)
+	return result.predictions, result.err
+}
+
+// PredictWithScorer is PredictNextChanges with candidate sites scored by scorer instead
+// of the DefaultScorer.
+//
+// Deprecated: use PredictWithOptions with Options.Scorer set.
+func PredictWithScorer(oldText, newText string, scorer Scorer) ([]PredictedChange, error) {
+	return PredictWithOptions(context.Background(), oldText, newText, Options{Scorer: scorer})
+}
+
+// PredictCasePreserving is PredictNextChanges for renames across naming conventions.
+// In addition to the exact predictions, it derives the camelCase, PascalCase,
+// snake_case, SCREAMING_SNAKE_CASE and kebab-case variants of the replaced text and
+// predicts the replacement written in the same convention wherever a variant occurs:
+// after userId -> accountId, USER_ID becomes ACCOUNT_ID and user-id becomes account-id.
+//
+// Deprecated: use PredictWithOptions with Options.CasePreserving set.
+func PredictCasePreserving(oldText, newText string) ([]PredictedChange, error) {
+	return PredictWithOptions(context.Background(), oldText, newText, Options{CasePreserving: true})
+}
+
+// SuggestRename reports whether the change from oldText to newText renames an
+// identifier and, if so, returns the rename as one grouped suggestion covering every
+// remaining whole-token occurrence. It returns nil if the change is not a rename.
+func SuggestRename(oldText, newText string) (*RenameSuggestion, error) {
+	return predict(oldText, newText, newConfig(Options{})).rename, nil
+}
+
+// PredictWithMultiLineContext is PredictNextChanges with anchors also scored on the
+// context beyond the changed line: the surrounding lines, the enclosing indentation block
+// and the nearest preceding header line, weighted as configured in weights.
+//
+// Deprecated: use PredictWithOptions with Options.Scorer set to the DefaultScorer
+// combined with weights.
+func PredictWithMultiLineContext(oldText, newText string, weights MultiLineContext) ([]PredictedChange, error) {
+	scorer := Combine(WeightedScorer{DefaultScorer(), 1}, WeightedScorer{weights, 1})
+	return PredictWithOptions(context.Background(), oldText, newText, Options{Scorer: scorer})
+}
 
+// PredictLineChanges predicts whole-line edits. If the change from oldText to newText
+// deletes, comments out, uncomments, duplicates or moves entire lines, the same operation
+// is predicted on the other lines with similar content, reported as line ranges in line
+// order.
+func PredictLineChanges(oldText, newText string) ([]PredictedLineChange, error) {
+	return PredictLineChangesWithOptions(context.Background(), oldText, newText, Options{Sort: SortByPosition})
+}
+
+// PredictLineChangesWithOptions is PredictLineChanges configured by opts. Of the Options,
+// MinScore, MaxResults, Sort, Timeout and Logger apply to line operations. It returns
+// ctx's error if ctx is already done, and the lines found so far with an error wrapping
+// ErrTruncated if ctx is done or opts.Timeout passes while predicting.
+func PredictLineChangesWithOptions(ctx context.Context, oldText, newText string, opts Options) ([]PredictedLineChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cfg, cancel := startConfig(ctx, opts)
+	defer cancel()
+	d := analyzeLineDiff(cfg.ctx, oldText, newText)
+	group := dominantLineEditGroup(d.edits)
+	cfg.logger.Debug("analyzed line diff", "stage", "lines", "edits", len(d.edits), "repeated", len(group))
+	predictions := finishLineChanges(generateLineOperationPredictions(d, group, cfg), opts)
+	err := cfg.truncated()
+	cfg.logger.Debug("finished line predictions", "stage", "output", "count", len(predictions), "truncated", err != nil)
+	return predictions, err
+}
+
+// predictionResult is everything a run of the prediction pipeline produces.
+type predictionResult struct {
+	predictions []PredictedChange
+	rename      *RenameSuggestion // Set when the change renames an identifier
+	err         error             // Set when the run stopped early; the predictions are then partial
+}
+
+// predict runs the prediction pipeline on a pair of text versions.
+func predict(oldText, newText string, cfg config) predictionResult {
 	// 1. Calculate Diffs
-	dmp := diffmatchpatch.New()
-	diffs := dmp.DiffMain(oldText, newText, true) // Use character-level diff
-	log.Printf("DEBUG: Diffs: %s", dmp.DiffPrettyText(diffs))
+	diffs := computeDiffs(cfg.ctx, oldText, newText, cfg.DiffMode)
+	cfg.logger.Debug("computed diffs", "stage", "diff", "mode", cfg.DiffMode, "ops", len(diffs))
+	return predictFromDiffs(oldText, newText, diffs, cfg)
+}
+
+// predictFromDiffs runs the prediction pipeline from the diffs between a pair of text
+// versions.
+func predictFromDiffs(oldText, newText string, diffs []diffmatchpatch.Diff, cfg config) predictionResult {
+	if cfg.done() {
+		// The diff may be coarser than the minimal one, and the search would stop at once
+		cfg.logger.Debug("truncated", "stage", "diff")
+		return predictionResult{predictions: []PredictedChange{}, err: cfg.truncated()}
+	}
+
+	// 2. Analyze Diffs: extract every change hunk and pick the edit the user has made
+	// most often (the first one on a tie) as the pattern to repeat
+	edits := extractEdits(diffs)
+	group := dominantEditGroup(edits)
+	cfg.trace.setDiffs(diffs)
+	cfg.trace.setChange(edits, group)
+	if len(group) == 0 {
+		cfg.logger.Debug("no changes found", "stage", "edits")
+		return predictionResult{predictions: []PredictedChange{}}
+	}
+	charsAdded, charsRemoved := group[0].Added, group[0].Removed
+	cfg.logger.Debug("extracted change", "stage", "edits", "edits", len(edits), "repeated", len(group),
+		"pos", group[0].OldPos, "removed", charsRemoved, "added", charsAdded)
+
+	var result predictionResult
+	from, to, seeds := charsRemoved, charsAdded, group
+	if renameFrom, renameTo, renamed, ok := detectRename(oldText, newText, group, cfg); ok {
+		from, to, seeds = renameFrom, renameTo, renamed
+		cfg.logger.Debug("detected rename", "stage", "rename", "from", from, "to", to)
+		cfg.trace.setRename(from, to)
+		// 3./4. Renaming a whole identifier: predict renaming every other whole-token
+		// occurrence, never substrings of longer identifiers
+		anchors := findIdentifierAnchors(oldText, renamed, cfg)
+		result.rename = generateRenamePredictions(newText, anchors, from, to, diffs, cfg)
+		result.predictions = result.rename.Changes
+	} else {
+		// 3. Find and Score Anchors based on removed text (or the insertion point context
+		// for pure insertions), using every occurrence of the edit as context evidence
+		anchors := findAnchorsForEdits(oldText, group, cfg)
 
-	// 2. Analyze Diffs to get removed text (first block) and original change start position
-	charsAdded, charsRemoved, originalChangeStartPos := analyzeDiffs(oldText, diffs)
+		// 4. Generate Predictions from Anchors
+		result.predictions = generatePredictions(newText, anchors, charsAdded, charsRemoved, diffs, cfg)
+	}
 
-	// 3. Find and Score Anchors based on removed text and local context comparison
-	// TODO: Adapt anchor finding/scoring for insertions/replacements
-	anchors := findAndScoreAnchors(oldText, charsAdded, charsRemoved, originalChangeStartPos)
+	// 4b. Repeat the replacement in the other naming conventions (USER_ID -> ACCOUNT_ID
+	// after userId -> accountId)
+	if cfg.CasePreserving && from != "" && to != "" && !cfg.done() {
+		variants := generateCaseVariantPredictions(oldText, newText, from, to, seeds, diffs, cfg)
+		result.predictions = append(result.predictions, variants...)
+	}
 
-	// 4. Generate Predictions from Anchors
-	predictions := generatePredictions(newText, anchors, charsAdded, charsRemoved, diffs)
-	// TODO: Add prediction generation logic for insertions/replacements
+	// 5. Generalize the edit into a template with holes, so the same refactoring is
+	// predicted at sites whose arguments differ from the original
+	if tmpl := buildEditTemplate(oldText, newText, edits, group[0], diffs, cfg); tmpl != nil && !cfg.done() {
+		cfg.logger.Debug("built edit template", "stage", "template", "pattern", tmpl.String(), "holes", tmpl.holeNames, "hunks", tmpl.hunks)
+		cfg.trace.setTemplate(tmpl)
+		fromTemplate := generateTemplatePredictions(oldText, newText, tmpl, edits, diffs, cfg)
+		merged := mergeTemplatePredictions(result.predictions, fromTemplate, tmpl.hunks > 1)
+		cfg.trace.rejectDropped(result.predictions, merged, reasonReplacedTemplate, "exact", "insertion", "identifier")
+		cfg.trace.rejectDropped(fromTemplate, merged, reasonOverlaps, "template")
+		result.predictions = merged
+	}
 
-	// 5. Sort/Filter Predictions (Optional)
-	// Sort predictions by score (descending) - higher score is more likely
-	// sort.Slice(predictions, func(i, j int) bool {
-	// 	return predictions[i].Score > predictions[j].Score
-	// })
+	// 6. Sort and filter predictions; by default the highest score, i.e. the most likely
+	// prediction, comes first
+	finished := finishPredictions(result.predictions, cfg.Options)
+	for _, p := range result.predictions {
+		if cfg.trace == nil || slices.Contains(finished, p) {
+			continue
+		}
+		if p.Score < cfg.MinScore {
+			cfg.trace.reject(p.Position, reasonBelowMinScore)
+		} else {
+			cfg.trace.reject(p.Position, reasonBeyondMaxResults)
+		}
+	}
+	result.predictions = finished
+	if cfg.RangeUnit != 0 {
+		addRanges(result.predictions, newText, cfg.RangeUnit)
+	}
+	if result.rename != nil {
+		// The rename covers the final predictions, including those merged in from the
+		// case variants and the edit template
+		result.rename.Changes = result.predictions
+	}
+	result.err = cfg.truncated()
+	cfg.logger.Debug("finished predictions", "stage", "output", "count", len(result.predictions), "truncated", result.err != nil)
 
-	return predictions, nil
+	return result
 }
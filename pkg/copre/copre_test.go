@@ -210,11 +210,97 @@ func TestPredictNextChanges(t *testing.T) {
 			newText: "replace NEW with new\n" +
 				"line 2\n" +
 				"replace OLD with new",
-			// Diff will see "OLD" deleted at pos 8
+			// Diff will see "OLD" replaced by "NEW" at pos 8
 			expected: []PredictedChange{
-				// Anchor found at pos 30. Context prefix="replace ", affix=" with new"
+				// Anchor found at pos 36. Context prefix="replace ", affix=" with new"
 				// Score: 5 (base) + 8 (prefix) + 9 (affix) = 22
-				{Position: 36, TextToRemove: "OLD", Line: 3, Score: 22, MappedPosition: 36},
+				{Position: 36, TextToRemove: "OLD", TextToAdd: "NEW", Line: 3, Score: 22, MappedPosition: 36},
+			},
+			expectErr: false,
+		},
+		{
+			// Tests a replacement whose two sides share characters, which a raw
+			// character diff would split into fragments.
+			name: "Replacement with overlapping characters",
+			oldText: "id := userId\n" +
+				"log(userId)",
+			newText: "id := accountId\n" +
+				"log(userId)",
+			expected: []PredictedChange{
+				// Recognised as a rename of the whole identifier userId -> accountId.
+				// Score: 5 (base) + 0 (prefix "log(" vs "id := ") + 0 (affix ")" vs "")
+				{Position: 17, TextToRemove: "userId", TextToAdd: "accountId", Line: 2, Score: 5, MappedPosition: 20},
+			},
+			expectErr: false,
+		},
+		{
+			// Tests that a deletion already repeated twice is learned from both hunks.
+			name: "Repeated deletion across hunks",
+			oldText: "alpha-x\n" +
+				"beta-x\n" +
+				"gamma-x\n" +
+				"delta-x",
+			newText: "alpha\n" +
+				"beta\n" +
+				"gamma-x\n" +
+				"delta-x",
+			expected: []PredictedChange{
+				// Score: 5 (base) + 1 (prefix "a", either example) + 2 (one repetition)
+				{Position: 20, TextToRemove: "-x", Line: 3, Score: 8, MappedPosition: 16},
+				// Score: 5 (base) + 2 (prefix "ta", from "beta") + 2 (one repetition)
+				{Position: 28, TextToRemove: "-x", Line: 4, Score: 9, MappedPosition: 24},
+			},
+			expectErr: false,
+		},
+		{
+			// Tests that the most frequent edit drives prediction, not the first one.
+			name: "Dominant edit wins over first edit",
+			oldText: "x := 1;\n" +
+				"y := 2;\n" +
+				"z := 3;\n" +
+				"w := 4;",
+			newText: "let x := 1;\n" +
+				"y := 2\n" +
+				"z := 3\n" +
+				"w := 4;",
+			expected: []PredictedChange{
+				{Position: 6, TextToRemove: ";", Line: 1, Score: 7, MappedPosition: 10},
+				{Position: 30, TextToRemove: ";", Line: 4, Score: 7, MappedPosition: 32},
+			},
+			expectErr: false,
+		},
+		{
+			// Tests a call rewrite that the diff splits into several hunks, repeated at
+			// call sites with different arguments.
+			name: "Edit template with different arguments",
+			oldText: "\tlog.Printf(\"x: %d\", a)\n" +
+				"\tlog.Printf(\"x: %d\", b.Count(c))\n" +
+				"\tlog.Printf(\"y: %d\", d)",
+			newText: "\tslog.Info(\"x\", \"v\", a)\n" +
+				"\tlog.Printf(\"x: %d\", b.Count(c))\n" +
+				"\tlog.Printf(\"y: %d\", d)",
+			expected: []PredictedChange{
+				// The argument is captured as a sub-expression; line 3 has a different format string.
+				// Score: 5 (base) + 1 (prefix "\t")
+				{Position: 25, TextToRemove: "log.Printf(\"x: %d\", b.Count(c))", TextToAdd: "slog.Info(\"x\", \"v\", b.Count(c))", Line: 2, Score: 6, MappedPosition: 25},
+			},
+			expectErr: false,
+		},
+		{
+			// Tests repeating an inserted argument at an analogous call site.
+			name: "Repeated insertion",
+			oldText: "foo(a)\n" +
+				"bar(a)\n" +
+				"foo(b)",
+			newText: "foo(a, ctx)\n" +
+				"bar(a)\n" +
+				"foo(b)",
+			expected: []PredictedChange{
+				// Surrounded by "a" and ")" like the original insertion point.
+				// Score: 5 (base) + 2 (prefix "(a") + 1 (affix ")") = 8
+				{Position: 12, TextToAdd: ", ctx", Line: 2, Score: 8, MappedPosition: 17},
+				// Same call with a different argument, matched by the edit template foo($1).
+				{Position: 14, TextToRemove: "foo(b)", TextToAdd: "foo(b, ctx)", Line: 3, Score: 5, MappedPosition: 19},
 			},
 			expectErr: false,
 		},
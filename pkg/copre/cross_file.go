@@ -0,0 +1,185 @@
+package copre
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+)
+
+// File is a file to search for other sites of an edit.
+type File struct {
+	Path string // Identifies the file; files in the same directory are siblings (see PredictAcrossFiles)
+	Text string
+}
+
+// FilePrediction is a prediction in one of several files. In a file other than the
+// edited one, the text has not changed, so Position and MappedPosition are the same.
+type FilePrediction struct {
+	Path string `json:"path"`
+	PredictedChange
+}
+
+// Bonuses added to the score of predictions across files, since an edit is most often
+// repeated close to where it was made.
+const (
+	sameFileBonus    = 3 // In the edited file
+	siblingFileBonus = 1 // In a file in the same directory as the edited file
+)
+
+// PredictAcrossFiles learns the edit from oldText to newText, two versions of the file
+// at path, and predicts repeating it both in that file, as PredictWithOptions does, and
+// in files, which are searched for the removed text (whole identifiers only for a
+// rename) or, for an insertion, for the tokens around the insertion point. A file in
+// files with the same path as the edited file is skipped.
+//
+// Sites elsewhere are scored against the edited sites like sites in the edited file.
+// Predictions in the edited file then get a bonus, and predictions in its siblings, the
+// files in the same directory, a smaller one, so that with equal context nearby
+// predictions rank first. opts apply to all predictions together: they are sorted
+// across files, ties going to the edited file and then to files in the order given,
+// and opts.MaxResults limits the total. Errors are as for PredictWithOptions.
+func PredictAcrossFiles(ctx context.Context, path, oldText, newText string, files []File, opts Options) ([]FilePrediction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cfg, cancel := startConfig(ctx, opts)
+	defer cancel()
+	cfg.logger.Debug("predicting across files", "stage", "input", "path", path, "files", len(files))
+
+	// Predict in the edited file first, filtering and sorting only once all files are done
+	diffs := computeDiffs(cfg.ctx, oldText, newText, cfg.DiffMode)
+	cfg.logger.Debug("computed diffs", "stage", "diff", "mode", cfg.DiffMode, "ops", len(diffs))
+	local := cfg
+	local.MinScore, local.MaxResults, local.Sort = 0, 0, SortNone
+	result := predictFromDiffs(oldText, newText, diffs, local)
+	predictions := []FilePrediction{}
+	for _, p := range result.predictions {
+		p.Score += sameFileBonus
+		predictions = append(predictions, FilePrediction{Path: path, PredictedChange: p})
+	}
+
+	group := dominantEditGroup(extractEdits(diffs))
+	if len(group) == 0 || cfg.done() {
+		return finishFilePredictions(predictions, path, files, opts), cfg.truncated()
+	}
+	added, wholeTokens := group[0].Added, false
+	if _, to, renamed, ok := detectRename(oldText, newText, group, cfg); ok {
+		group, added, wholeTokens = renamed, to, true
+	}
+
+	dir := filepath.Dir(path)
+	for _, f := range files {
+		if cfg.done() {
+			break
+		}
+		if f.Path == path {
+			continue
+		}
+		bonus := 0
+		if filepath.Dir(f.Path) == dir {
+			bonus = siblingFileBonus
+		}
+		var found []PredictedChange
+		for _, anchor := range findFileAnchors(f.Text, oldText, group, wholeTokens, cfg) {
+			p := PredictedChange{
+				Position:       anchor.Position,
+				TextToAdd:      added,
+				Line:           anchor.Line,
+				Score:          anchor.Score + bonus,
+				MappedPosition: anchor.Position,
+			}
+			if removed := group[0].Removed; removed != "" {
+				p.TextToRemove = f.Text[anchor.Position : anchor.Position+len(removed)]
+			} else if strings.HasPrefix(f.Text[anchor.Position:], added) || strings.HasSuffix(f.Text[:anchor.Position], added) {
+				continue // The insertion is already there
+			}
+			found = append(found, p)
+		}
+		if cfg.RangeUnit != 0 {
+			addRanges(found, f.Text, cfg.RangeUnit)
+		}
+		for _, p := range found {
+			predictions = append(predictions, FilePrediction{Path: f.Path, PredictedChange: p})
+		}
+		cfg.logger.Debug("searched file", "stage", "anchors", "path", f.Path, "count", len(found))
+	}
+	return finishFilePredictions(predictions, path, files, opts), cfg.truncated()
+}
+
+// findFileAnchors finds the sites in text, a file other than the edited one, where the
+// edits in group, made to oldText, can be repeated. Each site is scored against the
+// edit whose context it matches best and reinforced by the number of edits, like
+// findAnchorsForEdits. With wholeTokens, occurrences inside longer identifiers are not
+// sites.
+func findFileAnchors(text, oldText string, group []Edit, wholeTokens bool, cfg config) []Anchor {
+	anchors := []Anchor{}
+	originals := make([]Site, len(group))
+	oldSites := newSiteText(oldText)
+	for i, e := range group {
+		originals[i] = oldSites.site(e.OldPos, len(e.Removed))
+	}
+	sites := newSiteText(text)
+	addAnchor := func(pos, length int) {
+		candidate := sites.site(pos, length)
+		score := bestScore(cfg.scorer, originals, candidate).Total + repeatedEditBonus*(len(group)-1)
+		anchors = append(anchors, Anchor{Position: pos, Score: score, Line: candidate.Line})
+	}
+
+	if removed := group[0].Removed; removed != "" {
+		for searchStart := 0; searchStart < len(text) && !cfg.done(); {
+			foundPos := indexFold(text[searchStart:], removed, cfg.CaseInsensitive)
+			if foundPos == -1 {
+				break
+			}
+			pos := searchStart + foundPos
+			searchStart = pos + len(removed)
+			if !wholeTokens || isWholeToken(text, pos, pos+len(removed)) {
+				addAnchor(pos, len(removed))
+			}
+		}
+		return anchors
+	}
+
+	// Pure insertion: look for the tokens around each insertion point, as
+	// findInsertionAnchors does
+	seen := make(map[int]bool)
+	for _, original := range originals {
+		before, after := trailingToken(original.Prefix), leadingToken(original.Affix)
+		if before == "" && after == "" {
+			continue
+		}
+		for searchStart := 0; searchStart <= len(text) && !cfg.done(); {
+			foundPos := strings.Index(text[searchStart:], before+after)
+			if foundPos == -1 {
+				break
+			}
+			pos := searchStart + foundPos + len(before)
+			searchStart += foundPos + 1
+			candidate := sites.site(pos, 0)
+			if seen[pos] || trailingToken(candidate.Prefix) != before || leadingToken(candidate.Affix) != after {
+				continue
+			}
+			seen[pos] = true
+			addAnchor(pos, 0)
+		}
+	}
+	return anchors
+}
+
+// finishFilePredictions sorts predictions across files and applies the score threshold
+// and result limit. Ties, and the files themselves when sorting by position, are ordered
+// with the edited file at path first and then as in files.
+func finishFilePredictions(predictions []FilePrediction, path string, files []File, opts Options) []FilePrediction {
+	order := map[string]int{path: 0}
+	for i, f := range files {
+		if _, ok := order[f.Path]; !ok {
+			order[f.Path] = i + 1
+		}
+	}
+	return finish(predictions, opts, func(p FilePrediction) int { return p.Score }, func(a, b FilePrediction) bool {
+		if order[a.Path] != order[b.Path] {
+			return order[a.Path] < order[b.Path]
+		}
+		return a.Position < b.Position
+	})
+}
@@ -0,0 +1,113 @@
+package copre
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPredictAcrossFiles(t *testing.T) {
+	const (
+		oldText = "x := userId\ny := userId\n"
+		newText = "x := accountId\ny := userId\n"
+	)
+	files := []File{
+		{Path: "other/b.go", Text: "z := userId\n"},
+		{Path: "pkg/c.go", Text: "a := userId // userIdx\n"},
+		{Path: "pkg/a.go", Text: newText}, // The edited file itself
+	}
+	tests := []struct {
+		name string
+		opts Options
+		want []FilePrediction
+	}{
+		{
+			// With the same context everywhere, the edited file ranks before its sibling,
+			// and the sibling before files elsewhere; userIdx is not the renamed identifier
+			name: "ranking",
+			want: []FilePrediction{
+				{Path: "pkg/a.go", PredictedChange: PredictedChange{Position: 17, TextToRemove: "userId", TextToAdd: "accountId", Line: 2, Score: 12, MappedPosition: 20}},
+				{Path: "pkg/c.go", PredictedChange: PredictedChange{Position: 5, TextToRemove: "userId", TextToAdd: "accountId", Line: 1, Score: 10, MappedPosition: 5}},
+				{Path: "other/b.go", PredictedChange: PredictedChange{Position: 5, TextToRemove: "userId", TextToAdd: "accountId", Line: 1, Score: 9, MappedPosition: 5}},
+			},
+		},
+		{
+			name: "by position with a limit",
+			opts: Options{Sort: SortByPosition, MaxResults: 2},
+			want: []FilePrediction{
+				{Path: "pkg/a.go", PredictedChange: PredictedChange{Position: 17, TextToRemove: "userId", TextToAdd: "accountId", Line: 2, Score: 12, MappedPosition: 20}},
+				{Path: "other/b.go", PredictedChange: PredictedChange{Position: 5, TextToRemove: "userId", TextToAdd: "accountId", Line: 1, Score: 9, MappedPosition: 5}},
+			},
+		},
+		{
+			name: "minimum score",
+			opts: Options{MinScore: 10},
+			want: []FilePrediction{
+				{Path: "pkg/a.go", PredictedChange: PredictedChange{Position: 17, TextToRemove: "userId", TextToAdd: "accountId", Line: 2, Score: 12, MappedPosition: 20}},
+				{Path: "pkg/c.go", PredictedChange: PredictedChange{Position: 5, TextToRemove: "userId", TextToAdd: "accountId", Line: 1, Score: 10, MappedPosition: 5}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PredictAcrossFiles(context.Background(), "pkg/a.go", oldText, newText, files, tt.opts)
+			if err != nil {
+				t.Fatalf("PredictAcrossFiles() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PredictAcrossFiles() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredictAcrossFilesInsertion(t *testing.T) {
+	files := []File{{Path: "b.go", Text: "close(a)\nclose(b)?\n"}}
+	got, err := PredictAcrossFiles(context.Background(), "a.go", "close(x)\n", "close(x)?\n", files, Options{})
+	if err != nil {
+		t.Fatalf("PredictAcrossFiles() error = %v", err)
+	}
+	want := []FilePrediction{
+		{Path: "b.go", PredictedChange: PredictedChange{Position: 8, TextToAdd: "?", Line: 1, Score: 7, MappedPosition: 8}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PredictAcrossFiles() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPredictAcrossFilesCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := PredictAcrossFiles(ctx, "a.go", "a", "b", nil, Options{}); err == nil {
+		t.Errorf("PredictAcrossFiles() error = nil, want the context's error")
+	}
+}
+
+func TestPredictAcrossFilesMultiLineContext(t *testing.T) {
+	const (
+		oldText = "func load() {\n\tx := read(b)\n}\n"
+		newText = "func load() {\n\tx := fetch(b)\n}\n"
+	)
+	// The sites in other files are on lines beyond the end of the edited file, and only
+	// the one in a function shares its block and header
+	padding := strings.Repeat("// padding\n", 20)
+	files := []File{
+		{Path: "pkg/b.go", Text: padding + "func save() {\n\ty := read(b)\n}\n"},
+		{Path: "pkg/c.go", Text: padding + "var y = read(b)\n"},
+	}
+	opts := Options{Scorer: Combine(WeightedScorer{DefaultScorer(), 1}, WeightedScorer{DefaultMultiLineContext(), 1})}
+	got, err := PredictAcrossFiles(context.Background(), "pkg/a.go", oldText, newText, files, opts)
+	if err != nil {
+		t.Fatalf("PredictAcrossFiles() error = %v", err)
+	}
+	want := []FilePrediction{
+		// 12 (same line) + 1 (sibling) + 2 (line "}" below) + 3 (block opened by func) + 5 (func header)
+		{Path: "pkg/b.go", PredictedChange: PredictedChange{Position: 240, TextToRemove: "read", TextToAdd: "fetch", Line: 22, Score: 23, MappedPosition: 240}},
+		// 10 (same line) + 1 (sibling); no multi-line context in common
+		{Path: "pkg/c.go", PredictedChange: PredictedChange{Position: 228, TextToRemove: "read", TextToAdd: "fetch", Line: 21, Score: 11, MappedPosition: 228}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PredictAcrossFiles() = %+v, want %+v", got, want)
+	}
+}
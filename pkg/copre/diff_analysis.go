@@ -1,86 +1,66 @@
 package copre
 
 import (
-	"log"
-
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
-// analyzeDiffs processes the diffs to find the starting position of the first change
-// and the text removed/added in the first continuous block of deletions/insertions.
-func analyzeDiffs(oldText string, diffs []diffmatchpatch.Diff) (charsAdded, charsRemoved string, originalChangeStartPos int) {
-	originalChangeStartPos = -1 // Initialize to -1
-	firstChangePosFound := false
-	firstDeletionBlockEnded := false
-	firstInsertionBlockEnded := false // Track end of first insertion block
-	// oldPos := 0 // Declared but not used
-
-	// First pass: find the start position of the first change
-	tempOldPos := 0
+// extractEdits walks the diffs and returns every contiguous block of deletions and
+// insertions as an Edit, in the order they appear in the text.
+func extractEdits(diffs []diffmatchpatch.Diff) []Edit {
+	edits := []Edit{}
+	oldPos, newPos := 0, 0
+	inBlock := false
 	for _, diff := range diffs {
-		isChange := diff.Type == diffmatchpatch.DiffInsert || diff.Type == diffmatchpatch.DiffDelete
-		if !firstChangePosFound && isChange {
-			originalChangeStartPos = tempOldPos
-			firstChangePosFound = true
-			// break // No, need to continue to calculate oldPos correctly for the second pass
-		}
-		if diff.Type != diffmatchpatch.DiffInsert { // Only advance if not an insert
-			tempOldPos += len(diff.Text)
+		switch diff.Type {
+		case diffmatchpatch.DiffEqual:
+			inBlock = false
+			oldPos += len(diff.Text)
+			newPos += len(diff.Text)
+			continue
 		}
-	}
 
-	// Second pass: find the chars removed/added in the first block of deletions/insertions
-	firstChangePosFound = false // Reset for this pass
-	for _, diff := range diffs {
-		isChange := diff.Type == diffmatchpatch.DiffInsert || diff.Type == diffmatchpatch.DiffDelete
-		if !firstChangePosFound && isChange {
-			firstChangePosFound = true
+		if !inBlock {
+			edits = append(edits, Edit{OldPos: oldPos, NewPos: newPos})
+			inBlock = true
 		}
-
+		current := &edits[len(edits)-1]
 		if diff.Type == diffmatchpatch.DiffDelete {
-			// Only add to charsRemoved if it's part of the first block
-			if firstChangePosFound && !firstDeletionBlockEnded {
-				charsRemoved += diff.Text
-			}
-		} else if firstChangePosFound {
-			// If we found the first change and this diff is NOT a delete,
-			// then the first block of deletions (if any) has ended.
-			firstDeletionBlockEnded = true
+			current.Removed += diff.Text
+			oldPos += len(diff.Text)
+		} else {
+			current.Added += diff.Text
+			newPos += len(diff.Text)
 		}
+	}
+	return edits
+}
 
-		if diff.Type == diffmatchpatch.DiffInsert {
-			// Only add to charsAdded if it's part of the first block
-			if firstChangePosFound && !firstInsertionBlockEnded {
-				charsAdded += diff.Text
-			}
-		} else if firstChangePosFound {
-			// If we found the first change and this diff is NOT an insert,
-			// then the first block of insertions (if any) has ended.
-			firstInsertionBlockEnded = true
+// groupEdits groups edits that represent the same change (same removed and added text).
+// Groups are returned in the order of their first edit.
+func groupEdits(edits []Edit) [][]Edit {
+	var groups [][]Edit
+	index := make(map[Edit]int) // Keyed on the change itself, positions zeroed
+	for _, e := range edits {
+		key := Edit{Removed: e.Removed, Added: e.Added}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
 		}
-
-		// This part is only needed if we still calculate prefix/affix, which we are removing
-		// if diff.Type != diffmatchpatch.DiffInsert {
-		// 	oldPos += len(diff.Text)
-		// }
+		groups[i] = append(groups[i], e)
 	}
-
-	log.Printf("DEBUG: Characters added (first block): %q", charsAdded)
-	log.Printf("DEBUG: Characters removed (first block): %q", charsRemoved)
-	// log.Printf("DEBUG: Prefix context: %q", prefix) // Removed
-	// log.Printf("DEBUG: Affix context: %q", affix) // Removed
-	log.Printf("DEBUG: Original change start position: %d", originalChangeStartPos)
-
-	return charsAdded, charsRemoved, originalChangeStartPos
+	return groups
 }
 
-// contains checks if a slice contains an integer.
-// Keep this here as it might be useful, though not currently used by analyzeDiffs
-func contains(slice []int, item int) bool {
-	for _, a := range slice {
-		if a == item {
-			return true
+// dominantEditGroup returns the group of identical edits that occurs most often in edits.
+// Ties are broken in favour of the group whose first edit comes first.
+func dominantEditGroup(edits []Edit) []Edit {
+	var dominant []Edit
+	for _, group := range groupEdits(edits) {
+		if len(group) > len(dominant) {
+			dominant = group
 		}
 	}
-	return false
+	return dominant
 }
@@ -1,12 +1,13 @@
 package copre
 
 import (
+	"reflect"
 	"testing"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
-// Helper function to create diffs for testing mapPosition and analyzeDiffs
+// Helper function to create diffs for testing mapPosition and extractEdits
 // Copied from position_mapping_test.go
 func makeDiffsForAnalysis(ops [][2]interface{}) []diffmatchpatch.Diff {
 	var diffs []diffmatchpatch.Diff
@@ -18,145 +19,176 @@ func makeDiffsForAnalysis(ops [][2]interface{}) []diffmatchpatch.Diff {
 	return diffs
 }
 
-func TestAnalyzeDiffs(t *testing.T) {
-	dmp := diffmatchpatch.New()
+func TestExtractEdits(t *testing.T) {
 	tests := []struct {
-		name                       string
-		oldText                    string
-		newText                    string
-		wantCharsAdded             string
-		wantCharsRemoved           string
-		wantOriginalChangeStartPos int
+		name             string
+		diffs            []diffmatchpatch.Diff
+		oldText, newText string // Diffed by character when diffs is nil
+		want             []Edit
 	}{
 		{
-			name:                       "No change",
-			oldText:                    "hello world",
-			newText:                    "hello world",
-			wantCharsAdded:             "",
-			wantCharsRemoved:           "",
-			wantOriginalChangeStartPos: -1, // No change occurred
+			name:  "No change",
+			diffs: makeDiffsForAnalysis([][2]interface{}{{diffmatchpatch.DiffEqual, "abc"}}),
+			want:  []Edit{},
+		},
+		{
+			name: "Single replacement",
+			diffs: makeDiffsForAnalysis([][2]interface{}{
+				{diffmatchpatch.DiffEqual, "a "},
+				{diffmatchpatch.DiffDelete, "old"},
+				{diffmatchpatch.DiffInsert, "new"},
+				{diffmatchpatch.DiffEqual, " b"},
+			}),
+			want: []Edit{{OldPos: 2, NewPos: 2, Removed: "old", Added: "new"}},
 		},
 		{
-			name:                       "Single line insertion",
-			oldText:                    "hello world",
-			newText:                    "hello new world",
-			wantCharsAdded:             " new",
-			wantCharsRemoved:           "",
-			wantOriginalChangeStartPos: 6, // Position after "hello "
+			name: "Multiple hunks track positions in both texts",
+			diffs: makeDiffsForAnalysis([][2]interface{}{
+				{diffmatchpatch.DiffInsert, "let "},
+				{diffmatchpatch.DiffEqual, "x;\n"},
+				{diffmatchpatch.DiffDelete, "yy"},
+				{diffmatchpatch.DiffEqual, ";\n"},
+				{diffmatchpatch.DiffDelete, "z"},
+				{diffmatchpatch.DiffInsert, "w"},
+			}),
+			want: []Edit{
+				{OldPos: 0, NewPos: 0, Added: "let "},
+				{OldPos: 3, NewPos: 7, Removed: "yy"},
+				{OldPos: 7, NewPos: 9, Removed: "z", Added: "w"},
+			},
 		},
 		{
-			name:                       "Single line deletion",
-			oldText:                    "hello cruel world",
-			newText:                    "hello world",
-			wantCharsAdded:             "",
-			wantCharsRemoved:           "cruel ",
-			wantOriginalChangeStartPos: 6, // Position after "hello "
+			name:    "Single line insertion",
+			oldText: "hello world",
+			newText: "hello new world",
+			want:    []Edit{{OldPos: 6, NewPos: 6, Added: "new "}},
 		},
 		{
-			name:                       "Single line replacement",
-			oldText:                    "hello old world",
-			newText:                    "hello new world",
-			wantCharsAdded:             "new",
-			wantCharsRemoved:           "old",
-			wantOriginalChangeStartPos: 6, // Position after "hello "
+			name:    "Single line deletion",
+			oldText: "hello cruel world",
+			newText: "hello world",
+			want:    []Edit{{OldPos: 6, NewPos: 6, Removed: "cruel "}},
 		},
 		{
-			name:                       "Multi-line insertion",
-			oldText:                    "line1\nline3",
-			newText:                    "line1\nline2\nline3",
-			wantCharsAdded:             "\nline2",
-			wantCharsRemoved:           "",
-			wantOriginalChangeStartPos: 5, // Position after "line1"
+			name:    "Single line replacement",
+			oldText: "hello old world",
+			newText: "hello new world",
+			want:    []Edit{{OldPos: 6, NewPos: 6, Removed: "old", Added: "new"}},
 		},
 		{
-			name:                       "Multi-line deletion",
-			oldText:                    "line1\nline2\nline3",
-			newText:                    "line1\nline3",
-			wantCharsAdded:             "",
-			wantCharsRemoved:           "\nline2",
-			wantOriginalChangeStartPos: 5, // Position after "line1"
+			name:    "Multi-line insertion",
+			oldText: "line1\nline3",
+			newText: "line1\nline2\nline3",
+			want:    []Edit{{OldPos: 10, NewPos: 10, Added: "2\nline"}}, // The character diff aligns the insertion after "line"
 		},
 		{
-			name:                       "Multi-line replacement",
-			oldText:                    "line1\nlineOLD\nline3",
-			newText:                    "line1\nlineNEW\nline3",
-			wantCharsAdded:             "lineNEW",
-			wantCharsRemoved:           "lineOLD",
-			wantOriginalChangeStartPos: 6, // Start of "lineOLD"
+			name:    "Multi-line deletion",
+			oldText: "line1\nline2\nline3",
+			newText: "line1\nline3",
+			want:    []Edit{{OldPos: 10, NewPos: 10, Removed: "2\nline"}}, // The character diff aligns the deletion after "line"
 		},
 		{
-			name:                       "Change at start",
-			oldText:                    "old world",
-			newText:                    "new world",
-			wantCharsAdded:             "new",
-			wantCharsRemoved:           "old",
-			wantOriginalChangeStartPos: 0,
+			name:    "Change at start",
+			oldText: "old world",
+			newText: "new world",
+			want:    []Edit{{OldPos: 0, NewPos: 0, Removed: "old", Added: "new"}},
 		},
 		{
-			name:                       "Change at end",
-			oldText:                    "hello old",
-			newText:                    "hello new",
-			wantCharsAdded:             "new",
-			wantCharsRemoved:           "old",
-			wantOriginalChangeStartPos: 6,
+			name:    "Change at end",
+			oldText: "hello old",
+			newText: "hello new",
+			want:    []Edit{{OldPos: 6, NewPos: 6, Removed: "old", Added: "new"}},
 		},
 		{
-			name:                       "Multiple single line changes",
-			oldText:                    "rm A\nKeep\nrm B",
-			newText:                    "A\nKeep\nB",
-			wantCharsAdded:             "",
-			wantCharsRemoved:           "rm ", // Only captures context of *first* change sequence
-			wantOriginalChangeStartPos: 0,     // Position of first "rm "
+			name:    "Multiple single line changes",
+			oldText: "rm A\nKeep\nrm B",
+			newText: "A\nKeep\nB",
+			want:    []Edit{{OldPos: 0, NewPos: 0, Removed: "rm "}, {OldPos: 10, NewPos: 7, Removed: "rm "}},
 		},
 		{
-			name:                       "Empty old text",
-			oldText:                    "",
-			newText:                    "abc",
-			wantCharsAdded:             "abc",
-			wantCharsRemoved:           "",
-			wantOriginalChangeStartPos: 0,
+			name:    "Empty old text",
+			oldText: "",
+			newText: "abc",
+			want:    []Edit{{OldPos: 0, NewPos: 0, Added: "abc"}},
 		},
 		{
-			name:                       "Empty new text",
-			oldText:                    "abc",
-			newText:                    "",
-			wantCharsAdded:             "",
-			wantCharsRemoved:           "abc",
-			wantOriginalChangeStartPos: 0,
+			name:    "Empty new text",
+			oldText: "abc",
+			newText: "",
+			want:    []Edit{{OldPos: 0, NewPos: 0, Removed: "abc"}},
 		},
 		{
-			name:                       "Both empty",
-			oldText:                    "",
-			newText:                    "",
-			wantCharsAdded:             "",
-			wantCharsRemoved:           "",
-			wantOriginalChangeStartPos: -1, // No change
+			name:    "Both empty",
+			oldText: "",
+			newText: "",
+			want:    []Edit{},
+		},
+		{
+			name: "Multi-line replacement",
+			diffs: makeDiffsForAnalysis([][2]interface{}{
+				{diffmatchpatch.DiffEqual, "line1\n"},
+				{diffmatchpatch.DiffDelete, "lineOLD"},
+				{diffmatchpatch.DiffInsert, "lineNEW"},
+				{diffmatchpatch.DiffEqual, "\nline3"},
+			}),
+			want: []Edit{{OldPos: 6, NewPos: 6, Removed: "lineOLD", Added: "lineNEW"}},
 		},
 	}
 
+	dmp := diffmatchpatch.New()
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			diffs := dmp.DiffMain(tt.oldText, tt.newText, true)
-			// Special handling for multi-line replacement test case to get expected add/remove
-			if tt.name == "Multi-line replacement" {
-				diffs = makeDiffsForAnalysis([][2]interface{}{ // Use the local makeDiffs
-					{diffmatchpatch.DiffEqual, "line1\n"},
-					{diffmatchpatch.DiffDelete, "lineOLD"},
-					{diffmatchpatch.DiffInsert, "lineNEW"},
-					{diffmatchpatch.DiffEqual, "\nline3"},
-				})
+			diffs := tt.diffs
+			if diffs == nil {
+				diffs = dmp.DiffMain(tt.oldText, tt.newText, true)
 			}
-
-			gotCharsAdded, gotCharsRemoved, gotOriginalChangeStartPos := analyzeDiffs(tt.oldText, diffs)
-			// Check only the outputs that are still returned
-			if gotCharsAdded != tt.wantCharsAdded {
-				t.Errorf("analyzeDiffs() gotCharsAdded = %q, want %q", gotCharsAdded, tt.wantCharsAdded)
-			}
-			if gotCharsRemoved != tt.wantCharsRemoved {
-				t.Errorf("analyzeDiffs() gotCharsRemoved = %q, want %q", gotCharsRemoved, tt.wantCharsRemoved)
+			got := extractEdits(diffs)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractEdits() = %+v, want %+v", got, tt.want)
 			}
-			if gotOriginalChangeStartPos != tt.wantOriginalChangeStartPos {
-				t.Errorf("analyzeDiffs() gotOriginalChangeStartPos = %d, want %d", gotOriginalChangeStartPos, tt.wantOriginalChangeStartPos)
+		})
+	}
+}
+
+func TestDominantEditGroup(t *testing.T) {
+	tests := []struct {
+		name  string
+		edits []Edit
+		want  []Edit
+	}{
+		{
+			name:  "No edits",
+			edits: []Edit{},
+			want:  nil,
+		},
+		{
+			name: "Tie picks the first edit",
+			edits: []Edit{
+				{OldPos: 0, Added: "let "},
+				{OldPos: 9, Removed: ";"},
+			},
+			want: []Edit{{OldPos: 0, Added: "let "}},
+		},
+		{
+			name: "Most frequent edit wins",
+			edits: []Edit{
+				{OldPos: 0, Added: "let "},
+				{OldPos: 9, Removed: ";"},
+				{OldPos: 12, Removed: ";", Added: ""},
+				{OldPos: 20, Removed: ";", Added: ","},
+			},
+			want: []Edit{
+				{OldPos: 9, Removed: ";"},
+				{OldPos: 12, Removed: ";"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dominantEditGroup(tt.edits)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("dominantEditGroup() = %+v, want %+v", got, tt.want)
 			}
 		})
 	}
@@ -0,0 +1,359 @@
+package copre
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// LineOperation is the kind of a whole-line edit.
+type LineOperation string
+
+const (
+	LineDelete    LineOperation = "delete"    // The line is removed
+	LineComment   LineOperation = "comment"   // A comment marker is added in front of the line
+	LineUncomment LineOperation = "uncomment" // The comment marker in front of the line is removed
+	LineDuplicate LineOperation = "duplicate" // A copy of the line is inserted below it
+	LineMove      LineOperation = "move"      // The line is moved to another place
+)
+
+// PredictedLineChange is a predicted whole-line edit. Line numbers are 1-based and
+// ranges are inclusive.
+type PredictedLineChange struct {
+	Operation  LineOperation `json:"operation"`
+	StartLine  int           `json:"startLine"`            // First line of the range in oldText
+	EndLine    int           `json:"endLine"`              // Last line of the range in oldText
+	MappedLine int           `json:"mappedLine"`           // Line in newText where StartLine is now
+	TargetLine int           `json:"targetLine,omitempty"` // For LineMove: the line in newText the range starts at once moved; 0 otherwise
+	Text       string        `json:"text"`                 // The range after the operation: the copy for LineDuplicate, empty for LineDelete
+	Score      int           `json:"score"`                // Confidence score for this prediction
+}
+
+// commentMarkers are the line comment markers recognised when lines are commented out.
+var commentMarkers = []string{"//", "#", "--", ";"}
+
+// lineEdit is a whole-line edit found in the line diff of two texts.
+type lineEdit struct {
+	op       LineOperation
+	oldLine  int    // Index of the edited line in the old lines (the copied line for LineDuplicate)
+	marker   string // For comment operations: the marker added or removed, with trailing whitespace
+	atIndent bool   // For comment operations: the marker follows the indentation, not column 0
+	delta    int    // For LineMove: how many lines the line moved down (negative is up)
+}
+
+// lineDiff is the line-level diff of two texts.
+type lineDiff struct {
+	oldLines, newLines []string // Lines without their line breaks
+	oldToNew           map[int]int
+	edits              []lineEdit // Whole-line edits in the order of their old lines
+}
+
+// withTrailingNewline terminates the last line of a non-empty text, so that the last
+// line compares equal to the same line elsewhere in the line diff.
+func withTrailingNewline(text string) string {
+	if text == "" || strings.HasSuffix(text, "\n") {
+		return text
+	}
+	return text + "\n"
+}
+
+// splitLines splits newline-terminated text into lines without their line breaks.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// commentMarkerAdded reports whether after is before with a comment marker inserted in
+// front of it, either after its indentation or at column 0.
+func commentMarkerAdded(before, after string) (marker string, atIndent bool, ok bool) {
+	indent := len(before) - len(strings.TrimLeft(before, " \t"))
+	for _, k := range []int{indent, 0} {
+		if len(after) <= len(before) || after[:k] != before[:k] || !strings.HasSuffix(after, before[k:]) {
+			continue
+		}
+		inserted := after[k : len(after)-len(before)+k]
+		for _, m := range commentMarkers {
+			if strings.TrimRight(inserted, " \t") == m {
+				return inserted, k == indent, true
+			}
+		}
+	}
+	return "", false, false
+}
+
+// analyzeLineDiff diffs oldText and newText line by line and classifies the changed lines
+// into whole-line edits. Changed lines that are none of the LineOperations are ignored.
+// If ctx has a deadline, the line diff is given up to then to find the minimal diff.
+func analyzeLineDiff(ctx context.Context, oldText, newText string) lineDiff {
+	oldText, newText = withTrailingNewline(oldText), withTrailingNewline(newText)
+	d := lineDiff{
+		oldLines: splitLines(oldText),
+		newLines: splitLines(newText),
+		oldToNew: make(map[int]int),
+	}
+	newToOld := make(map[int]int)
+
+	dmp := diffmatchpatch.New()
+	if deadline, ok := ctx.Deadline(); ok {
+		dmp.DiffTimeout = max(time.Until(deadline), time.Nanosecond)
+	}
+	oldChars, newChars, lineArray := dmp.DiffLinesToChars(oldText, newText)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMain(oldChars, newChars, false), lineArray)
+
+	type changedLine struct {
+		index    int
+		text     string
+		replaced bool // The line is part of a block that deletes and inserts lines
+	}
+	var deleted, inserted, blockDeleted, blockInserted []changedLine
+	// A block of deleted lines replaced by as many lines, each the same line with a
+	// comment marker added (or removed), comments the block out (or in).
+	flushBlock := func() {
+		toggles := []lineEdit{}
+		if len(blockDeleted) == len(blockInserted) {
+			for i, del := range blockDeleted {
+				if marker, atIndent, ok := commentMarkerAdded(del.text, blockInserted[i].text); ok {
+					toggles = append(toggles, lineEdit{op: LineComment, oldLine: del.index, marker: marker, atIndent: atIndent})
+				} else if marker, atIndent, ok := commentMarkerAdded(blockInserted[i].text, del.text); ok {
+					toggles = append(toggles, lineEdit{op: LineUncomment, oldLine: del.index, marker: marker, atIndent: atIndent})
+				} else {
+					break
+				}
+			}
+		}
+		if len(blockDeleted) > 0 && len(toggles) == len(blockDeleted) {
+			d.edits = append(d.edits, toggles...)
+		} else {
+			for _, del := range blockDeleted {
+				del.replaced = len(blockInserted) > 0
+				deleted = append(deleted, del)
+			}
+			inserted = append(inserted, blockInserted...)
+		}
+		blockDeleted, blockInserted = nil, nil
+	}
+
+	oldIndex, newIndex := 0, 0
+	for _, diff := range diffs {
+		for _, line := range splitLines(diff.Text) {
+			switch diff.Type {
+			case diffmatchpatch.DiffEqual:
+				d.oldToNew[oldIndex] = newIndex
+				newToOld[newIndex] = oldIndex
+				oldIndex++
+				newIndex++
+			case diffmatchpatch.DiffDelete:
+				blockDeleted = append(blockDeleted, changedLine{index: oldIndex, text: line})
+				oldIndex++
+			case diffmatchpatch.DiffInsert:
+				blockInserted = append(blockInserted, changedLine{index: newIndex, text: line})
+				newIndex++
+			}
+		}
+		if diff.Type == diffmatchpatch.DiffEqual {
+			flushBlock()
+		}
+	}
+	flushBlock()
+
+	// An inserted line is a copy of an unchanged neighbour (duplicate) or of a deleted
+	// line (move). A deleted line that is neither moved nor replaced by other lines is a
+	// deletion. Blank lines are never treated as line operations.
+	moved := make([]bool, len(deleted))
+	for _, ins := range inserted {
+		if strings.TrimSpace(ins.text) == "" {
+			continue
+		}
+		if source, ok := duplicateSource(d.newLines, newToOld, ins.index); ok {
+			d.edits = append(d.edits, lineEdit{op: LineDuplicate, oldLine: source})
+			continue
+		}
+		for i, del := range deleted {
+			if !moved[i] && del.text == ins.text {
+				moved[i] = true
+				d.edits = append(d.edits, lineEdit{op: LineMove, oldLine: del.index, delta: ins.index - del.index})
+				break
+			}
+		}
+	}
+	for i, del := range deleted {
+		if !moved[i] && !del.replaced && strings.TrimSpace(del.text) != "" {
+			d.edits = append(d.edits, lineEdit{op: LineDelete, oldLine: del.index})
+		}
+	}
+
+	sort.SliceStable(d.edits, func(i, j int) bool { return d.edits[i].oldLine < d.edits[j].oldLine })
+	return d
+}
+
+// duplicateSource returns the old index of the unchanged line directly above or below
+// the inserted new line index that has the same text, if any.
+func duplicateSource(newLines []string, newToOld map[int]int, index int) (int, bool) {
+	for _, neighbour := range []int{index - 1, index + 1} {
+		if neighbour < 0 || neighbour >= len(newLines) || newLines[neighbour] != newLines[index] {
+			continue
+		}
+		if source, ok := newToOld[neighbour]; ok {
+			return source, true
+		}
+	}
+	return 0, false
+}
+
+// dominantLineEditGroup returns the line edits that repeat the operation occurring most
+// often, the earliest one on a tie, like dominantEditGroup.
+func dominantLineEditGroup(edits []lineEdit) []lineEdit {
+	var groups [][]lineEdit
+	index := make(map[lineEdit]int) // Keyed on the operation, line zeroed
+	for _, e := range edits {
+		key := e
+		key.oldLine = 0
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], e)
+	}
+	var dominant []lineEdit
+	for _, g := range groups {
+		if len(g) > len(dominant) {
+			dominant = g
+		}
+	}
+	return dominant
+}
+
+// lineSimilarity scores how alike two lines are: the length of their common prefix plus
+// their common suffix, ignoring indentation. The lines are similar if that covers at
+// least half of the original line.
+func lineSimilarity(original, candidate string) (int, bool) {
+	original, candidate = strings.TrimSpace(original), strings.TrimSpace(candidate)
+	if original == "" || candidate == "" {
+		return 0, false
+	}
+	prefix := commonPrefixLen(original, candidate)
+	similarity := prefix + commonSuffixLen(original[prefix:], candidate[prefix:])
+	return similarity, 2*similarity >= len(original)
+}
+
+// applyLineEdit returns the text of line after performing the operation of e on it, or
+// false if the operation does not apply to the line.
+func applyLineEdit(e lineEdit, line string) (string, bool) {
+	k := 0
+	if e.atIndent {
+		k = len(line) - len(strings.TrimLeft(line, " \t"))
+	}
+	switch e.op {
+	case LineComment:
+		if strings.HasPrefix(strings.TrimSpace(line), strings.TrimSpace(e.marker)) {
+			return "", false // Already commented out
+		}
+		return line[:k] + e.marker + line[k:], true
+	case LineUncomment:
+		if !strings.HasPrefix(line[k:], e.marker) {
+			return "", false
+		}
+		return line[:k] + line[k+len(e.marker):], true
+	case LineDelete:
+		return "", true
+	}
+	return line, true
+}
+
+// generateLineOperationPredictions predicts the operation of the line edits in group on
+// every unchanged line similar to one of the edited lines. Adjacent deleted, commented
+// and uncommented lines are merged into one range. If the run is cut short, the lines
+// found so far are returned.
+func generateLineOperationPredictions(d lineDiff, group []lineEdit, cfg config) []PredictedLineChange {
+	predictions := []PredictedLineChange{}
+	if len(group) == 0 {
+		return predictions
+	}
+
+	edited := make(map[int]bool)
+	for _, e := range d.edits {
+		edited[e.oldLine] = true
+	}
+	// Consecutive lines edited together count as one repetition of the operation
+	repetitions := 0
+	for i, e := range group {
+		if i == 0 || e.oldLine != group[i-1].oldLine+1 {
+			repetitions++
+		}
+	}
+
+	for i, line := range d.oldLines {
+		newLine, unchanged := d.oldToNew[i]
+		if !unchanged || edited[i] {
+			continue
+		}
+		if cfg.done() {
+			cfg.logger.Debug("truncated", "stage", "lines", "line", i+1)
+			break
+		}
+		score := 0
+		for _, e := range group {
+			if similarity, ok := lineSimilarity(d.oldLines[e.oldLine], line); ok {
+				score = max(score, baseScore+similarity)
+			}
+		}
+		if score == 0 {
+			continue
+		}
+		score += repeatedEditBonus * (repetitions - 1)
+
+		e := group[0]
+		text, ok := applyLineEdit(e, line)
+		if !ok {
+			continue
+		}
+		p := PredictedLineChange{Operation: e.op, StartLine: i + 1, EndLine: i + 1, MappedLine: newLine + 1, Text: text, Score: score}
+		switch e.op {
+		case LineDuplicate:
+			if i+1 < len(d.oldLines) && d.oldLines[i+1] == line {
+				continue // Already duplicated
+			}
+		case LineMove:
+			p.TargetLine = min(max(newLine+e.delta, 0), len(d.newLines)-1) + 1
+		}
+
+		if n := len(predictions); n > 0 && mergeableLineChanges(predictions[n-1], p) {
+			last := &predictions[n-1]
+			last.EndLine = p.EndLine
+			if last.Operation != LineDelete {
+				last.Text += "\n" + p.Text
+			}
+			last.Score = max(last.Score, p.Score)
+			continue
+		}
+		predictions = append(predictions, p)
+	}
+	return predictions
+}
+
+// finishLineChanges sorts and filters line predictions as opts asks, like
+// finishPredictions: SortByPosition orders them by StartLine.
+func finishLineChanges(predictions []PredictedLineChange, opts Options) []PredictedLineChange {
+	return finish(predictions, opts, func(p PredictedLineChange) int { return p.Score }, func(a, b PredictedLineChange) bool {
+		return a.StartLine < b.StartLine
+	})
+}
+
+// mergeableLineChanges reports whether next continues the range of prev.
+func mergeableLineChanges(prev, next PredictedLineChange) bool {
+	switch prev.Operation {
+	case LineDelete, LineComment, LineUncomment:
+	default:
+		return false
+	}
+	return next.Operation == prev.Operation &&
+		next.StartLine == prev.EndLine+1 &&
+		next.MappedLine == prev.MappedLine+(prev.EndLine-prev.StartLine)+1
+}
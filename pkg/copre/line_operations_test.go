@@ -0,0 +1,184 @@
+package copre
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPredictLineChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		want    []PredictedLineChange
+	}{
+		{
+			name: "Delete line",
+			oldText: "a := 1\n" +
+				"log.Printf(\"DEBUG: a=%d\", a)\n" +
+				"b := 2\n" +
+				"log.Printf(\"DEBUG: b=%d\", b)\n" +
+				"fmt.Println(a + b)\n",
+			newText: "a := 1\n" +
+				"b := 2\n" +
+				"log.Printf(\"DEBUG: b=%d\", b)\n" +
+				"fmt.Println(a + b)\n",
+			want: []PredictedLineChange{
+				// Score: 5 (base) + 19 (prefix `log.Printf("DEBUG: `) + 1 (suffix ")")
+				{Operation: LineDelete, StartLine: 4, EndLine: 4, MappedLine: 3, Score: 25},
+			},
+		},
+		{
+			name: "Comment out adjacent lines as one range",
+			oldText: "func f() {\n" +
+				"\tdebug(x)\n" +
+				"\trun(x)\n" +
+				"\tdebug(y)\n" +
+				"\tdebug(z)\n" +
+				"}\n",
+			newText: "func f() {\n" +
+				"\t// debug(x)\n" +
+				"\trun(x)\n" +
+				"\tdebug(y)\n" +
+				"\tdebug(z)\n" +
+				"}\n",
+			want: []PredictedLineChange{
+				{Operation: LineComment, StartLine: 4, EndLine: 5, MappedLine: 4, Text: "\t// debug(y)\n\t// debug(z)", Score: 12},
+			},
+		},
+		{
+			name:    "Uncomment line",
+			oldText: "# a = 1\nb = 2\n# a = 3\n",
+			newText: "a = 1\nb = 2\n# a = 3\n",
+			want: []PredictedLineChange{
+				{Operation: LineUncomment, StartLine: 3, EndLine: 3, MappedLine: 3, Text: "a = 3", Score: 11},
+			},
+		},
+		{
+			name:    "Duplicate line without trailing newline",
+			oldText: "x.add(1)\ny := 0\nx.add(2)",
+			newText: "x.add(1)\nx.add(1)\ny := 0\nx.add(2)",
+			want: []PredictedLineChange{
+				{Operation: LineDuplicate, StartLine: 3, EndLine: 3, MappedLine: 4, Text: "x.add(2)", Score: 12},
+			},
+		},
+		{
+			name: "Move line",
+			oldText: "package p\n" +
+				"func a() {}\n" +
+				"import \"a\"\n" +
+				"func b() {}\n" +
+				"import \"b\"\n",
+			newText: "package p\n" +
+				"import \"a\"\n" +
+				"func a() {}\n" +
+				"func b() {}\n" +
+				"import \"b\"\n",
+			// The diff sees func a() moving down a line rather than import "a" moving up
+			want: []PredictedLineChange{
+				{Operation: LineMove, StartLine: 4, EndLine: 4, MappedLine: 4, TargetLine: 5, Text: "func b() {}", Score: 15},
+			},
+		},
+		{
+			name:    "In-line edit is not a line operation",
+			oldText: "a(1)\na(2)\n",
+			newText: "b(1)\na(2)\n",
+			want:    []PredictedLineChange{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PredictLineChanges(tt.oldText, tt.newText)
+			if err != nil {
+				t.Fatalf("PredictLineChanges() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PredictLineChanges() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommentMarkerAdded(t *testing.T) {
+	tests := []struct {
+		before, after string
+		wantMarker    string
+		wantAtIndent  bool
+		wantOK        bool
+	}{
+		{before: "\tfoo()", after: "\t// foo()", wantMarker: "// ", wantAtIndent: true, wantOK: true},
+		{before: "\tfoo()", after: "//\tfoo()", wantMarker: "//", wantAtIndent: false, wantOK: true},
+		{before: "x = 1", after: "#x = 1", wantMarker: "#", wantAtIndent: true, wantOK: true},
+		{before: "foo()", after: "bar foo()", wantOK: false},
+		{before: "foo()", after: "foo()", wantOK: false},
+	}
+	for _, tt := range tests {
+		marker, atIndent, ok := commentMarkerAdded(tt.before, tt.after)
+		if marker != tt.wantMarker || atIndent != tt.wantAtIndent || ok != tt.wantOK {
+			t.Errorf("commentMarkerAdded(%q, %q) = %q, %v, %v, want %q, %v, %v",
+				tt.before, tt.after, marker, atIndent, ok, tt.wantMarker, tt.wantAtIndent, tt.wantOK)
+		}
+	}
+}
+
+func TestPredictLineChangesWithOptions(t *testing.T) {
+	// Deleting the first debug line predicts deleting the other two, the closer match
+	// scoring higher
+	oldText := "log.Printf(\"DEBUG: a\")\n" +
+		"log.Print(\"c\")\n" +
+		"x := 1\n" +
+		"log.Printf(\"DEBUG: b=%d\", b)\n"
+	newText := "log.Print(\"c\")\n" +
+		"x := 1\n" +
+		"log.Printf(\"DEBUG: b=%d\", b)\n"
+	printLine := PredictedLineChange{Operation: LineDelete, StartLine: 2, EndLine: 2, MappedLine: 1, Score: 16}
+	debugLine := PredictedLineChange{Operation: LineDelete, StartLine: 4, EndLine: 4, MappedLine: 3, Score: 25}
+
+	tests := []struct {
+		name string
+		opts Options
+		want []PredictedLineChange
+	}{
+		{name: "Default sorts by score", opts: Options{}, want: []PredictedLineChange{debugLine, printLine}},
+		{name: "Sort by position", opts: Options{Sort: SortByPosition}, want: []PredictedLineChange{printLine, debugLine}},
+		{name: "MinScore", opts: Options{MinScore: 20}, want: []PredictedLineChange{debugLine}},
+		{name: "MaxResults", opts: Options{Sort: SortByPosition, MaxResults: 1}, want: []PredictedLineChange{printLine}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PredictLineChangesWithOptions(context.Background(), oldText, newText, tt.opts)
+			if err != nil {
+				t.Fatalf("PredictLineChangesWithOptions() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PredictLineChangesWithOptions() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := PredictLineChangesWithOptions(ctx, oldText, newText, Options{}); !errors.Is(err, context.Canceled) {
+			t.Errorf("PredictLineChangesWithOptions() error = %v, want %v", err, context.Canceled)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		// The context ends after the line diff, before any line is compared
+		ctx, cancel := context.WithCancel(context.Background())
+		cfg, stop := startConfig(ctx, Options{})
+		defer stop()
+		d := analyzeLineDiff(cfg.ctx, oldText, newText)
+		cancel()
+		if got := generateLineOperationPredictions(d, dominantLineEditGroup(d.edits), cfg); len(got) != 0 {
+			t.Errorf("generateLineOperationPredictions() = %+v, want none", got)
+		}
+		if err := cfg.truncated(); !errors.Is(err, ErrTruncated) || !errors.Is(err, context.Canceled) {
+			t.Errorf("truncated() = %v, want ErrTruncated and %v", err, context.Canceled)
+		}
+	})
+}
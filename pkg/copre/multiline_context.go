@@ -0,0 +1,108 @@
+package copre
+
+import "strings"
+
+// MultiLineContext is a Scorer for the context beyond the changed line, so that
+// predictions inside the same kind of block as the original change rank above
+// coincidental matches. Each weight is the number of points added for that kind of
+// evidence; a zero weight disables it. It is meant to be combined with the
+// DefaultScorer, e.g. with Combine.
+type MultiLineContext struct {
+	Lines        int // Number of lines above and below the change to compare
+	LineWeight   int // Points per surrounding line equal to the original's (ignoring indentation)
+	BlockWeight  int // Points when the enclosing indentation block is like the original's
+	HeaderWeight int // Points when the nearest preceding header line starts like the original's
+}
+
+// DefaultMultiLineContext returns the weights a MultiLineContext is typically used with.
+func DefaultMultiLineContext() MultiLineContext {
+	return MultiLineContext{Lines: 2, LineWeight: 2, BlockWeight: 3, HeaderWeight: 5}
+}
+
+// headerKeywords are the leading words of lines that open a block worth comparing, such
+// as a function, class or conditional.
+var headerKeywords = map[string]bool{
+	"func": true, "function": true, "def": true, "fn": true, "class": true, "struct": true,
+	"interface": true, "impl": true, "type": true, "module": true,
+	"if": true, "else": true, "elif": true, "for": true, "while": true, "switch": true,
+	"case": true, "match": true, "try": true, "catch": true, "with": true,
+}
+
+// indentation returns the byte length of the leading whitespace of line.
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
+
+// leadingWord returns the identifier the line starts with after its indentation.
+func leadingWord(line string) string {
+	line = strings.TrimLeft(line, " \t")
+	if end := strings.IndexFunc(line, func(r rune) bool { return !isIdentRune(r) }); end != -1 {
+		return line[:end]
+	}
+	return line
+}
+
+// blockOpener returns the nearest non-blank line above lines[index] that is indented less
+// than it, i.e. the line opening its indentation block, or "" at the top level.
+func blockOpener(lines []string, index int) string {
+	indent := indentation(lines[index])
+	for i := index - 1; i >= 0; i-- {
+		if strings.TrimSpace(lines[i]) != "" && indentation(lines[i]) < indent {
+			return lines[i]
+		}
+	}
+	return ""
+}
+
+// headerLine returns the nearest line at or above lines[index] that starts with one of the
+// headerKeywords, or "" if there is none.
+func headerLine(lines []string, index int) string {
+	for i := index; i >= 0; i-- {
+		if headerKeywords[leadingWord(lines[i])] {
+			return lines[i]
+		}
+	}
+	return ""
+}
+
+// Score implements Scorer.
+func (c MultiLineContext) Score(original, candidate Site) Score {
+	return c.score(original.textLines(), original.Line-1, candidate.textLines(), candidate.Line-1)
+}
+
+// score compares the multi-line context of originalLines[original], the line of the
+// original change, with that of candidateLines[candidate] and returns the points earned.
+// The two may be lines of different texts; a line number outside its text earns nothing.
+func (c MultiLineContext) score(originalLines []string, original int, candidateLines []string, candidate int) Score {
+	valid := original >= 0 && original < len(originalLines) && candidate >= 0 && candidate < len(candidateLines)
+	surrounding := 0
+	for d := 1; d <= c.Lines; d++ {
+		for _, offset := range []int{-d, d} {
+			o, a := original+offset, candidate+offset
+			if !valid || o < 0 || a < 0 || o >= len(originalLines) || a >= len(candidateLines) {
+				continue
+			}
+			if line := strings.TrimSpace(originalLines[o]); line != "" && line == strings.TrimSpace(candidateLines[a]) {
+				surrounding += c.LineWeight
+			}
+		}
+	}
+	block, header := 0, 0
+	if valid {
+		if indentation(originalLines[original]) == indentation(candidateLines[candidate]) &&
+			leadingWord(blockOpener(originalLines, original)) == leadingWord(blockOpener(candidateLines, candidate)) {
+			block = c.BlockWeight
+		}
+		if h := headerLine(originalLines, original); h != "" && leadingWord(h) == leadingWord(headerLine(candidateLines, candidate)) {
+			header = c.HeaderWeight
+		}
+	}
+	return Score{
+		Total: surrounding + block + header,
+		Breakdown: []ScoreComponent{
+			{Name: "lines", Points: surrounding},
+			{Name: "block", Points: block},
+			{Name: "header", Points: header},
+		},
+	}
+}
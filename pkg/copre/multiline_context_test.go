@@ -0,0 +1,134 @@
+package copre
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPredictWithMultiLineContext(t *testing.T) {
+	oldText := "func load() {\n" +
+		"\tx := get(a)\n" +
+		"\ty := read(b)\n" +
+		"}\n" +
+		"if ok {\n" +
+		"\ty := read(b)\n" +
+		"}\n" +
+		"func save() {\n" +
+		"\ty := read(b)\n" +
+		"}\n"
+	newText := "func load() {\n" +
+		"\tx := get(a)\n" +
+		"\ty := fetch(b)\n" +
+		"}\n" +
+		"if ok {\n" +
+		"\ty := read(b)\n" +
+		"}\n" +
+		"func save() {\n" +
+		"\ty := read(b)\n" +
+		"}\n"
+
+	tests := []struct {
+		name    string
+		weights MultiLineContext
+		want    []PredictedChange
+	}{
+		{
+			name:    "Same-line context only",
+			weights: MultiLineContext{},
+			want: []PredictedChange{
+				// Score: 5 (base) + 6 (prefix "\ty := ") + 3 (affix "(b)")
+				{Position: 57, TextToRemove: "read", TextToAdd: "fetch", Line: 6, Score: 14, MappedPosition: 58},
+				{Position: 87, TextToRemove: "read", TextToAdd: "fetch", Line: 9, Score: 14, MappedPosition: 88},
+			},
+		},
+		{
+			name:    "Same kind of block ranks higher",
+			weights: DefaultMultiLineContext(),
+			want: []PredictedChange{
+				// + 2 (line "}" below)
+				{Position: 57, TextToRemove: "read", TextToAdd: "fetch", Line: 6, Score: 16, MappedPosition: 58},
+				// + 2 (line "}" below) + 3 (block opened by func) + 5 (func header)
+				{Position: 87, TextToRemove: "read", TextToAdd: "fetch", Line: 9, Score: 24, MappedPosition: 88},
+			},
+		},
+		{
+			name:    "Header weight only",
+			weights: MultiLineContext{HeaderWeight: 10},
+			want: []PredictedChange{
+				{Position: 57, TextToRemove: "read", TextToAdd: "fetch", Line: 6, Score: 14, MappedPosition: 58},
+				{Position: 87, TextToRemove: "read", TextToAdd: "fetch", Line: 9, Score: 24, MappedPosition: 88},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PredictWithMultiLineContext(oldText, newText, tt.weights)
+			if err != nil {
+				t.Fatalf("PredictWithMultiLineContext() error = %v", err)
+			}
+			sortPredictions(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PredictWithMultiLineContext() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockOpenerAndHeaderLine(t *testing.T) {
+	lines := []string{
+		"class A:",
+		"    def f(self):",
+		"        if x:",
+		"            return 1",
+		"        return 2",
+	}
+	if got, want := blockOpener(lines, 3), "        if x:"; got != want {
+		t.Errorf("blockOpener(3) = %q, want %q", got, want)
+	}
+	if got, want := blockOpener(lines, 4), "    def f(self):"; got != want {
+		t.Errorf("blockOpener(4) = %q, want %q", got, want)
+	}
+	if got, want := blockOpener(lines, 0), ""; got != want {
+		t.Errorf("blockOpener(0) = %q, want %q", got, want)
+	}
+	if got, want := headerLine(lines, 4), "        if x:"; got != want {
+		t.Errorf("headerLine(4) = %q, want %q", got, want)
+	}
+}
+
+func TestMultiLineContextAcrossTexts(t *testing.T) {
+	original := newSite("func a() {\n\tx := read(b)\n}\n", 17, 4)
+	long := "// padding\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\n\nfunc c() {\n\tz := read(b)\n}\n"
+
+	tests := []struct {
+		name      string
+		candidate Site
+		want      int
+	}{
+		{
+			// The candidate's lines are its own text's: "}" below, the func block and header
+			name:      "Candidate in a longer text",
+			candidate: newSite(long, strings.Index(long, "read"), 4),
+			want:      2 + 3 + 5,
+		},
+		{
+			name:      "Candidate in a shorter text",
+			candidate: newSite("y := read(b)", 5, 4),
+			want:      0,
+		},
+		{
+			name:      "Site built by hand beyond its text",
+			candidate: Site{Text: "read", Line: 40},
+			want:      0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultMultiLineContext().Score(original, tt.candidate); got.Total != tt.want {
+				t.Errorf("Score() = %+v, want a total of %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,308 @@
+package copre
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// DiffMode selects the granularity at which the two texts are compared.
+type DiffMode int
+
+const (
+	DiffSemantic DiffMode = iota // Character diff with coincidental equalities merged (the default)
+	DiffChars                    // Raw character diff
+	DiffWords                    // Diff of words, whitespace runs and punctuation
+	DiffLines                    // Diff of whole lines
+)
+
+var diffModeNames = map[DiffMode]string{DiffSemantic: "semantic", DiffChars: "chars", DiffWords: "words", DiffLines: "lines"}
+
+// MarshalText implements encoding.TextMarshaler, writing "semantic", "chars", "words" or
+// "lines".
+func (m DiffMode) MarshalText() ([]byte, error) {
+	return marshalEnum(diffModeNames, m, "diff mode")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (m *DiffMode) UnmarshalText(text []byte) error {
+	return unmarshalEnum(diffModeNames, text, "diff mode", m)
+}
+
+// SortOrder is the order predictions are returned in.
+type SortOrder int
+
+const (
+	SortByScore    SortOrder = iota // Highest score first, then by position (the default)
+	SortByPosition                  // By position in the old text
+	SortNone                        // In the order the pipeline produced them
+)
+
+var sortOrderNames = map[SortOrder]string{SortByScore: "score", SortByPosition: "position", SortNone: "none"}
+
+// MarshalText implements encoding.TextMarshaler, writing "score", "position" or "none".
+func (o SortOrder) MarshalText() ([]byte, error) {
+	return marshalEnum(sortOrderNames, o, "sort order")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (o *SortOrder) UnmarshalText(text []byte) error {
+	return unmarshalEnum(sortOrderNames, text, "sort order", o)
+}
+
+// marshalEnum returns the name of v in names.
+func marshalEnum[T ~int](names map[T]string, v T, kind string) ([]byte, error) {
+	if name, ok := names[v]; ok {
+		return []byte(name), nil
+	}
+	return nil, fmt.Errorf("invalid %s %d", kind, int(v))
+}
+
+// unmarshalEnum sets *v to the value named text in names.
+func unmarshalEnum[T ~int](names map[T]string, text []byte, kind string, v *T) error {
+	for value, name := range names {
+		if name == string(text) {
+			*v = value
+			return nil
+		}
+	}
+	valid := make([]string, 0, len(names))
+	for value := range len(names) {
+		if name := names[T(value)]; name != "" {
+			valid = append(valid, name)
+		}
+	}
+	return fmt.Errorf("unknown %s %q (want %s)", kind, text, strings.Join(valid, ", "))
+}
+
+// Options configures PredictWithOptions. The zero value gives the defaults used by
+// PredictNextChanges.
+type Options struct {
+	DiffMode        DiffMode
+	MinScore        int           // If positive, predictions scoring below it are dropped
+	MaxResults      int           // If positive, at most this many predictions are returned (after sorting)
+	ContextWidth    int           // If positive, the DefaultScorer compares at most this many runes of context on each side
+	CaseInsensitive bool          // Find other occurrences of the removed text regardless of case
+	CasePreserving  bool          // Also predict the replacement in the other naming conventions (USER_ID -> ACCOUNT_ID after userId -> accountId)
+	Sort            SortOrder     // Order of the returned predictions
+	Scorer          Scorer        // Scores candidate sites; the DefaultScorer if nil
+	Timeout         time.Duration // If positive, the time budget of a run (see ErrTruncated)
+	RangeUnit       PositionUnit  // If set, predictions carry their Range, with columns in this unit
+
+	// Logger receives debug records for each pipeline stage, tagged with a "stage"
+	// attribute. Nothing is logged if nil.
+	Logger *slog.Logger
+}
+
+// ErrTruncated is returned, wrapped together with the context's error, when the context
+// of a prediction run is cancelled or its deadline (or Options.Timeout) passes before the
+// run is complete. The predictions returned with it are the best-effort partial result:
+// diffing, anchor search and scoring stop early, and the sites found so far are returned.
+var ErrTruncated = errors.New("copre: prediction truncated")
+
+// config holds the settings of one run of the prediction pipeline.
+type config struct {
+	Options
+	ctx    context.Context // Ends the run early when done, never nil
+	scorer Scorer          // The Scorer to use, never nil
+	logger *slog.Logger    // The Logger to use, never nil
+	trace  *Trace          // Records the run for Explain; nil otherwise
+	cut    *bool           // Set once a stage of the run has stopped early, never nil
+}
+
+// newConfig resolves opts into the settings of a pipeline run that is never cut short.
+func newConfig(opts Options) config {
+	cfg := config{Options: opts, ctx: context.Background(), scorer: opts.Scorer, logger: opts.Logger, cut: new(bool)}
+	if cfg.scorer == nil {
+		cfg.scorer = LocalContextScorer{Width: opts.ContextWidth}
+	}
+	if cfg.logger == nil {
+		cfg.logger = slog.New(slog.DiscardHandler)
+	}
+	return cfg
+}
+
+// startConfig resolves opts into the settings of a pipeline run bounded by ctx and
+// opts.Timeout. The caller must call cancel once the run is over.
+func startConfig(ctx context.Context, opts Options) (cfg config, cancel context.CancelFunc) {
+	cfg = newConfig(opts)
+	cancel = func() {}
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	cfg.ctx = ctx
+	return cfg, cancel
+}
+
+// done reports whether the run should stop early. Stages call it only when they have
+// work left, so a true result also records that the run is truncated.
+func (cfg config) done() bool {
+	if cfg.ctx.Err() == nil {
+		return false
+	}
+	*cfg.cut = true
+	return true
+}
+
+// truncated returns the error reporting that a stage of the run stopped early, or nil if
+// none did, even if the context has ended since the work was completed.
+func (cfg config) truncated() error {
+	if !*cfg.cut {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrTruncated, cfg.ctx.Err())
+}
+
+// computeDiffs diffs oldText and newText in the given mode. If ctx has a deadline, the
+// diff is given up to then to find the minimal diff, after which a valid but coarser diff
+// is returned.
+func computeDiffs(ctx context.Context, oldText, newText string, mode DiffMode) []diffmatchpatch.Diff {
+	dmp := diffmatchpatch.New()
+	if deadline, ok := ctx.Deadline(); ok {
+		// A zero timeout would mean no timeout at all
+		dmp.DiffTimeout = max(time.Until(deadline), time.Nanosecond)
+	}
+	switch mode {
+	case DiffChars:
+		return dmp.DiffMain(oldText, newText, true) // Use character-level diff
+	case DiffWords:
+		oldRunes, newRunes, words := wordsToRunes(oldText, newText)
+		return runesToWords(dmp.DiffMainRunes(oldRunes, newRunes, false), words)
+	case DiffLines:
+		oldChars, newChars, lines := dmp.DiffLinesToChars(oldText, newText)
+		return dmp.DiffCharsToLines(dmp.DiffMain(oldChars, newChars, false), lines)
+	}
+	diffs := dmp.DiffMain(oldText, newText, true)
+	// Merge coincidental single-character equalities so that a replacement such as
+	// "userId" -> "accountId" is seen as one deletion + insertion rather than fragments.
+	return dmp.DiffCleanupSemantic(diffs)
+}
+
+// wordTokens splits text into runs of identifier runes, runs of whitespace and single
+// other runes.
+func wordTokens(text string) []string {
+	var words []string
+	start := 0
+	kind := func(r rune) int {
+		switch {
+		case isIdentRune(r):
+			return 1
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			return 2
+		}
+		return 3
+	}
+	prev := 0
+	for i, r := range text {
+		k := kind(r)
+		if i > start && (k != prev || k == 3) {
+			words = append(words, text[start:i])
+			start = i
+		}
+		prev = k
+	}
+	if start < len(text) {
+		words = append(words, text[start:])
+	}
+	return words
+}
+
+// wordsToRunes encodes both texts as one rune per word, like DiffLinesToRunes does for
+// lines, so they can be diffed word by word. words maps the runes back.
+func wordsToRunes(oldText, newText string) (oldRunes, newRunes []rune, words []string) {
+	index := make(map[string]rune)
+	encode := func(text string) []rune {
+		var runes []rune
+		for _, w := range wordTokens(text) {
+			r, ok := index[w]
+			if !ok {
+				r = rune(len(words))
+				if r >= 0xD800 { // Skip the surrogate range, which strings cannot hold
+					r += 0x800
+				}
+				index[w] = r
+				words = append(words, w)
+			}
+			runes = append(runes, r)
+		}
+		return runes
+	}
+	oldRunes, newRunes = encode(oldText), encode(newText)
+	return oldRunes, newRunes, words
+}
+
+// runesToWords decodes diffs of texts encoded by wordsToRunes.
+func runesToWords(diffs []diffmatchpatch.Diff, words []string) []diffmatchpatch.Diff {
+	for i := range diffs {
+		var b strings.Builder
+		for _, r := range diffs[i].Text {
+			if r >= 0xD800+0x800 {
+				r -= 0x800
+			}
+			b.WriteString(words[r])
+		}
+		diffs[i].Text = b.String()
+	}
+	return diffs
+}
+
+// indexFold is strings.Index, ignoring case when fold is set. Case-insensitive matches
+// must have the same byte length as substr.
+func indexFold(s, substr string, fold bool) int {
+	if !fold {
+		return strings.Index(s, substr)
+	}
+	for i := range s {
+		if i+len(substr) <= len(s) && strings.EqualFold(s[i:i+len(substr)], substr) {
+			return i
+		}
+	}
+	return -1
+}
+
+// finishPredictions sorts predictions and applies the score threshold and result limit.
+func finishPredictions(predictions []PredictedChange, opts Options) []PredictedChange {
+	return finish(predictions, opts, func(p PredictedChange) int { return p.Score }, func(a, b PredictedChange) bool {
+		return a.Position < b.Position
+	})
+}
+
+// finish sorts a copy of predictions as opts.Sort asks, ordering by position with before
+// and breaking score ties the same way, then drops the predictions scoring below
+// opts.MinScore and keeps at most opts.MaxResults.
+func finish[T any](predictions []T, opts Options, score func(T) int, before func(a, b T) bool) []T {
+	predictions = append([]T{}, predictions...)
+	switch opts.Sort {
+	case SortByScore:
+		sort.SliceStable(predictions, func(i, j int) bool {
+			if si, sj := score(predictions[i]), score(predictions[j]); si != sj {
+				return si > sj
+			}
+			return before(predictions[i], predictions[j])
+		})
+	case SortByPosition:
+		sort.SliceStable(predictions, func(i, j int) bool {
+			return before(predictions[i], predictions[j])
+		})
+	}
+
+	if opts.MinScore > 0 {
+		kept := predictions[:0]
+		for _, p := range predictions {
+			if score(p) >= opts.MinScore {
+				kept = append(kept, p)
+			}
+		}
+		predictions = kept
+	}
+	if opts.MaxResults > 0 && len(predictions) > opts.MaxResults {
+		predictions = predictions[:opts.MaxResults]
+	}
+	return predictions
+}
@@ -0,0 +1,271 @@
+package copre
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPredictWithOptions(t *testing.T) {
+	// Deleting ".x" on line 2 predicts deleting it on lines 1 and 3; line 3 shares the
+	// prefix "foo" with the original and scores higher.
+	oldText := "bar.x\nfoo.x\nfoo.x"
+	newText := "bar.x\nfoo\nfoo.x"
+	line1 := PredictedChange{Position: 3, TextToRemove: ".x", Line: 1, Score: 5, MappedPosition: 3}
+	line3 := PredictedChange{Position: 15, TextToRemove: ".x", Line: 3, Score: 5 + 3, MappedPosition: 13}
+
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		opts    Options
+		want    []PredictedChange
+	}{
+		{
+			name: "Defaults sort by score",
+			opts: Options{},
+			want: []PredictedChange{line3, line1},
+		},
+		{
+			name: "Sort by position",
+			opts: Options{Sort: SortByPosition},
+			want: []PredictedChange{line1, line3},
+		},
+		{
+			name: "Minimum score",
+			opts: Options{MinScore: 6},
+			want: []PredictedChange{line3},
+		},
+		{
+			name: "Maximum results",
+			opts: Options{MaxResults: 1, Sort: SortByPosition},
+			want: []PredictedChange{line1},
+		},
+		{
+			name: "Context width",
+			opts: Options{ContextWidth: 1},
+			want: []PredictedChange{
+				{Position: 15, TextToRemove: ".x", Line: 3, Score: 5 + 1, MappedPosition: 13},
+				line1,
+			},
+		},
+		{
+			name:    "Case insensitive",
+			oldText: "x // TODO\ny // todo\nz // Todo",
+			newText: "x\ny // todo\nz // Todo",
+			opts:    Options{CaseInsensitive: true, Sort: SortByPosition},
+			want: []PredictedChange{
+				{Position: 11, TextToRemove: " // todo", Line: 2, Score: 5, MappedPosition: 3},
+				{Position: 21, TextToRemove: " // Todo", Line: 3, Score: 5, MappedPosition: 13},
+			},
+		},
+		{
+			name:    "Case sensitive by default",
+			oldText: "x // TODO\ny // todo\nz // Todo",
+			newText: "x\ny // todo\nz // Todo",
+			opts:    Options{},
+			want:    []PredictedChange{},
+		},
+		{
+			name:    "Word diff",
+			oldText: "count := 1\ncount++",
+			newText: "total := 1\ncount++",
+			opts:    Options{DiffMode: DiffWords},
+			want: []PredictedChange{
+				{Position: 11, TextToRemove: "count", TextToAdd: "total", Line: 2, Score: 5, MappedPosition: 11},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.oldText == "" {
+				tt.oldText, tt.newText = oldText, newText
+			}
+			got, err := PredictWithOptions(context.Background(), tt.oldText, tt.newText, tt.opts)
+			if err != nil {
+				t.Fatalf("PredictWithOptions() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PredictWithOptions() =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredictWithOptionsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := PredictWithOptions(ctx, "a", "b", Options{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("PredictWithOptions() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+// blockingScorer is the DefaultScorer, except that its first call runs stop and waits
+// for ctx to be done, so a run is always cut short while scoring.
+type blockingScorer struct {
+	ctx  context.Context
+	stop func()
+}
+
+func (s *blockingScorer) Score(original, candidate Site) Score {
+	if s.stop != nil {
+		s.stop()
+		s.stop = nil
+	}
+	<-s.ctx.Done()
+	return DefaultScorer().Score(original, candidate)
+}
+
+func TestPredictWithOptionsTruncated(t *testing.T) {
+	// Deleting ".a" on line 1 has three other sites; the run stops after scoring the first.
+	oldText := "x.a\nx.a\nx.a\nx.a"
+	newText := "x\nx.a\nx.a\nx.a"
+	want := []PredictedChange{{Position: 5, TextToRemove: ".a", Line: 2, Score: 5 + 1, MappedPosition: 3}}
+
+	t.Run("Cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		got, err := PredictWithOptions(ctx, oldText, newText, Options{Scorer: &blockingScorer{ctx: ctx, stop: cancel}})
+		if !errors.Is(err, ErrTruncated) || !errors.Is(err, context.Canceled) {
+			t.Errorf("PredictWithOptions() error = %v, want ErrTruncated and %v", err, context.Canceled)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("PredictWithOptions() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		// The scorer outlasts the time budget
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		got, err := PredictWithOptions(context.Background(), oldText, newText, Options{Scorer: &blockingScorer{ctx: ctx}, Timeout: 5 * time.Millisecond})
+		if !errors.Is(err, ErrTruncated) || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("PredictWithOptions() error = %v, want ErrTruncated and %v", err, context.DeadlineExceeded)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("PredictWithOptions() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("Within budget", func(t *testing.T) {
+		got, err := PredictWithOptions(context.Background(), oldText, newText, Options{Timeout: time.Minute})
+		if err != nil || len(got) != 3 {
+			t.Errorf("PredictWithOptions() = %+v, %v, want 3 predictions", got, err)
+		}
+	})
+}
+
+func TestConfigTruncated(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cfg, stop := startConfig(ctx, Options{})
+	defer stop()
+
+	// A context ending after the work is done does not make the run partial
+	cancel()
+	if err := cfg.truncated(); err != nil {
+		t.Errorf("truncated() = %v before any stage stopped, want nil", err)
+	}
+	if !cfg.done() {
+		t.Fatal("done() = false, want true")
+	}
+	if err := cfg.truncated(); !errors.Is(err, ErrTruncated) || !errors.Is(err, context.Canceled) {
+		t.Errorf("truncated() = %v after a stage stopped, want ErrTruncated and %v", err, context.Canceled)
+	}
+}
+
+func TestComputeDiffs(t *testing.T) {
+	tests := []struct {
+		name string
+		mode DiffMode
+		want []Edit
+	}{
+		{name: "Semantic", mode: DiffSemantic, want: []Edit{{OldPos: 2, NewPos: 2, Added: "r"}}},
+		{name: "Words", mode: DiffWords, want: []Edit{{OldPos: 0, NewPos: 0, Removed: "cat", Added: "cart"}}},
+		{name: "Lines", mode: DiffLines, want: []Edit{{OldPos: 0, NewPos: 0, Removed: "cat(a)\n", Added: "cart(a)\n"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractEdits(computeDiffs(context.Background(), "cat(a)\ncat(b)", "cart(a)\ncat(b)", tt.mode))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("extractEdits(computeDiffs()) = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWordTokens(t *testing.T) {
+	got := wordTokens("foo(a,  b)\n")
+	want := []string{"foo", "(", "a", ",", "  ", "b", ")", "\n"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wordTokens() = %q, want %q", got, want)
+	}
+}
+
+func TestPredictWithOptionsLogger(t *testing.T) {
+	// Nothing may reach the standard logger, with or without a Logger configured.
+	var std bytes.Buffer
+	log.SetOutput(&std)
+	defer log.SetOutput(os.Stderr)
+
+	if _, err := PredictWithOptions(context.Background(), "a-x\nb-x", "a\nb-x", Options{}); err != nil {
+		t.Fatalf("PredictWithOptions() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if _, err := PredictWithOptions(context.Background(), "a-x\nb-x", "a\nb-x", Options{Logger: logger}); err != nil {
+		t.Fatalf("PredictWithOptions() error = %v", err)
+	}
+
+	if std.Len() != 0 {
+		t.Errorf("standard logger got output:\n%s", std.String())
+	}
+	stages := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record struct{ Stage string }
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid log record %q: %v", line, err)
+		}
+		stages[record.Stage] = true
+	}
+	for _, stage := range []string{"input", "diff", "edits", "anchors", "predictions", "output"} {
+		if !stages[stage] {
+			t.Errorf("no log record for stage %q in:\n%s", stage, buf.String())
+		}
+	}
+}
+
+func TestOptionEnumsText(t *testing.T) {
+	for _, mode := range []DiffMode{DiffSemantic, DiffChars, DiffWords, DiffLines} {
+		text, _ := mode.MarshalText()
+		var got DiffMode
+		if err := got.UnmarshalText(text); err != nil || got != mode {
+			t.Errorf("DiffMode round trip of %q = %d, %v, want %d", text, got, err, mode)
+		}
+	}
+	for _, order := range []SortOrder{SortByScore, SortByPosition, SortNone} {
+		text, _ := order.MarshalText()
+		var got SortOrder
+		if err := got.UnmarshalText(text); err != nil || got != order {
+			t.Errorf("SortOrder round trip of %q = %d, %v, want %d", text, got, err, order)
+		}
+	}
+
+	var mode DiffMode
+	err := mode.UnmarshalText([]byte("bytes"))
+	if want := `unknown diff mode "bytes" (want semantic, chars, words, lines)`; err == nil || err.Error() != want {
+		t.Errorf("UnmarshalText(bytes) error = %v, want %s", err, want)
+	}
+	if _, err := DiffMode(9).MarshalText(); err == nil {
+		t.Errorf("MarshalText(9) succeeded")
+	}
+}
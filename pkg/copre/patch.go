@@ -0,0 +1,216 @@
+package copre
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// FilePatch is the part of a unified diff that changes one file.
+type FilePatch struct {
+	OldPath string `json:"oldPath"` // The path on the "---" line, without git's "a/" prefix; "/dev/null" for an added file
+	NewPath string `json:"newPath"` // The path on the "+++" line, without git's "b/" prefix; "/dev/null" for a deleted file
+	Hunks   []Hunk `json:"hunks"`
+}
+
+// Hunk is one "@@ -OldStart,OldLines +NewStart,NewLines @@" section of a unified diff.
+type Hunk struct {
+	OldStart int      `json:"oldStart"` // 1-based; for an empty range, the line before it
+	OldLines int      `json:"oldLines"`
+	NewStart int      `json:"newStart"`
+	NewLines int      `json:"newLines"`
+	Lines    []string `json:"lines"` // Each starting with ' ', '-' or '+', or "\" for "\ No newline at end of file"
+}
+
+// String returns the header of the hunk.
+func (h Hunk) String() string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OldStart, h.OldLines, h.NewStart, h.NewLines)
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// ParsePatch parses a unified diff of one or more files, as written by diff -u or git
+// diff. Lines outside the file sections, such as git's extended headers or a commit
+// message, are ignored, and so are files without hunks, such as binary files.
+func ParsePatch(patch string) ([]FilePatch, error) {
+	files := []FilePatch{}
+	lines := strings.Split(strings.TrimSuffix(patch, "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			oldPath, newPath := patchPath(line[4:]), patchPath(lines[i+1][4:])
+			if strings.HasPrefix(oldPath, "a/") && strings.HasPrefix(newPath, "b/") {
+				oldPath, newPath = oldPath[2:], newPath[2:]
+			}
+			files = append(files, FilePatch{OldPath: oldPath, NewPath: newPath})
+			i++
+		case strings.HasPrefix(line, "@@ "):
+			if len(files) == 0 {
+				return nil, fmt.Errorf("patch line %d: hunk before the first file header", i+1)
+			}
+			h, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			file := &files[len(files)-1]
+			file.Hunks = append(file.Hunks, h)
+			i = next - 1
+		}
+	}
+	return files, nil
+}
+
+// patchPath returns the path of a "---" or "+++" line, dropping the timestamp diff -u
+// appends after a tab.
+func patchPath(s string) string {
+	path, _, _ := strings.Cut(s, "\t")
+	return strings.TrimSpace(path)
+}
+
+// parseHunk parses the hunk whose header is lines[start] and returns it with the index
+// of the line after it.
+func parseHunk(lines []string, start int) (Hunk, int, error) {
+	m := hunkHeader.FindStringSubmatch(lines[start])
+	if m == nil {
+		return Hunk{}, 0, fmt.Errorf("patch line %d: malformed hunk header %q", start+1, lines[start])
+	}
+	number := func(s string) int {
+		if s == "" {
+			return 1 // An omitted count is 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	h := Hunk{OldStart: number(m[1]), OldLines: number(m[2]), NewStart: number(m[3]), NewLines: number(m[4])}
+
+	oldLeft, newLeft := h.OldLines, h.NewLines
+	i := start + 1
+	for ; i < len(lines) && (oldLeft > 0 || newLeft > 0 || strings.HasPrefix(lines[i], `\`)); i++ {
+		line := lines[i]
+		if line == "" {
+			line = " " // Some tools strip the space of empty context lines
+		}
+		switch line[0] {
+		case ' ':
+			oldLeft--
+			newLeft--
+		case '-':
+			oldLeft--
+		case '+':
+			newLeft--
+		case '\\':
+		default:
+			return Hunk{}, 0, fmt.Errorf("patch line %d: unexpected line %q in hunk %s", i+1, line, h)
+		}
+		if oldLeft < 0 || newLeft < 0 {
+			return Hunk{}, 0, fmt.Errorf("patch line %d: hunk %s has more lines than its header says", i+1, h)
+		}
+		h.Lines = append(h.Lines, line)
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return Hunk{}, 0, fmt.Errorf("patch line %d: hunk %s is truncated", i, h)
+	}
+	return h, i, nil
+}
+
+// OldText returns the text of the file before the patch, given newText, the text after
+// it. It fails if the hunks do not match newText.
+func (p FilePatch) OldText(newText string) (string, error) {
+	oldText, _, err := p.reverse(newText, func(removed, added string) []diffmatchpatch.Diff {
+		return []diffmatchpatch.Diff{{Type: diffmatchpatch.DiffDelete, Text: removed}, {Type: diffmatchpatch.DiffInsert, Text: added}}
+	})
+	return oldText, err
+}
+
+// reverse undoes the patch on newText and returns the old text with the diffs from it to
+// newText. Each block of removed and added lines in a hunk is diffed with diffBlock, so
+// only the changed lines are compared rather than the whole texts.
+func (p FilePatch) reverse(newText string, diffBlock func(removed, added string) []diffmatchpatch.Diff) (string, []diffmatchpatch.Diff, error) {
+	lines := strings.SplitAfter(newText, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var diffs []diffmatchpatch.Diff
+	var removed, added strings.Builder
+	flush := func() {
+		for _, d := range diffBlock(removed.String(), added.String()) {
+			diffs = appendDiff(diffs, d.Type, d.Text)
+		}
+		removed.Reset()
+		added.Reset()
+	}
+
+	next := 0 // The next line of newText
+	for _, h := range p.Hunks {
+		start := h.NewStart - 1
+		if h.NewLines == 0 {
+			start = h.NewStart // An empty range starts after the line given
+		}
+		if start < next || start > len(lines) {
+			return "", nil, fmt.Errorf("%s: hunk %s is out of order or beyond the end of the file", p.NewPath, h)
+		}
+		diffs = appendDiff(diffs, diffmatchpatch.DiffEqual, strings.Join(lines[next:start], ""))
+		next = start
+
+		for i, line := range h.Lines {
+			if line[0] == '\\' {
+				continue
+			}
+			text := line[1:]
+			if i+1 >= len(h.Lines) || h.Lines[i+1][0] != '\\' {
+				text += "\n"
+			}
+			if line[0] != '-' {
+				if next >= len(lines) || lines[next] != text {
+					got := ""
+					if next < len(lines) {
+						got = lines[next]
+					}
+					return "", nil, fmt.Errorf("%s: hunk %s does not match line %d: %q, want %q", p.NewPath, h, next+1, got, text)
+				}
+				next++
+			}
+			switch line[0] {
+			case ' ':
+				flush()
+				diffs = appendDiff(diffs, diffmatchpatch.DiffEqual, text)
+			case '-':
+				removed.WriteString(text)
+			case '+':
+				added.WriteString(text)
+			}
+		}
+		flush()
+	}
+	diffs = appendDiff(diffs, diffmatchpatch.DiffEqual, strings.Join(lines[next:], ""))
+	return diffmatchpatch.New().DiffText1(diffs), diffs, nil
+}
+
+// PredictFromPatch predicts the next changes to a file from a patch of it and newText,
+// the file's text after the patch. The edits are learned from the patch's hunks: only
+// the lines each hunk changes are diffed, and the rest of the file is known to be
+// unchanged, instead of diffing the whole old and new texts. It fails if the hunks do
+// not match newText; otherwise it is PredictWithOptions on the text before the patch
+// and newText.
+func PredictFromPatch(ctx context.Context, patch FilePatch, newText string, opts Options) ([]PredictedChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cfg, cancel := startConfig(ctx, opts)
+	defer cancel()
+	cfg.logger.Debug("predicting from patch", "stage", "input", "path", patch.NewPath, "hunks", len(patch.Hunks), "newLen", len(newText))
+	oldText, diffs, err := patch.reverse(newText, func(removed, added string) []diffmatchpatch.Diff {
+		return computeDiffs(cfg.ctx, removed, added, cfg.DiffMode)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cfg.logger.Debug("computed diffs", "stage", "diff", "mode", cfg.DiffMode, "ops", len(diffs))
+	result := predictFromDiffs(oldText, newText, diffs, cfg)
+	return result.predictions, result.err
+}
@@ -0,0 +1,118 @@
+package copre
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const gitPatch = `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -1,3 +1,3 @@
+ package main
+-var a = userId
++var a = accountId
+ var b = userId
+@@ -6,2 +6,2 @@ func f() {
+-	g(userId)
++	g(accountId)
+ }
+diff --git a/other.txt b/other.txt
+--- a/other.txt
++++ b/other.txt
+@@ -1 +1,2 @@
+ one
++two
+\ No newline at end of file
+`
+
+func TestParsePatch(t *testing.T) {
+	got, err := ParsePatch(gitPatch)
+	if err != nil {
+		t.Fatalf("ParsePatch() error = %v", err)
+	}
+	want := []FilePatch{
+		{OldPath: "main.go", NewPath: "main.go", Hunks: []Hunk{
+			{OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 3, Lines: []string{" package main", "-var a = userId", "+var a = accountId", " var b = userId"}},
+			{OldStart: 6, OldLines: 2, NewStart: 6, NewLines: 2, Lines: []string{"-\tg(userId)", "+\tg(accountId)", " }"}},
+		}},
+		{OldPath: "other.txt", NewPath: "other.txt", Hunks: []Hunk{
+			{OldStart: 1, OldLines: 1, NewStart: 1, NewLines: 2, Lines: []string{" one", "+two", `\ No newline at end of file`}},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParsePatch() = %+v, want %+v", got, want)
+	}
+
+	// diff -u headers carry timestamps and no a/ and b/ prefixes
+	got, err = ParsePatch("--- old/f.txt\t2024-01-01 00:00:00\n+++ new/f.txt\t2024-01-02 00:00:00\n@@ -0,0 +1 @@\n+x\n")
+	if err != nil {
+		t.Fatalf("ParsePatch() error = %v", err)
+	}
+	if want := (FilePatch{OldPath: "old/f.txt", NewPath: "new/f.txt", Hunks: []Hunk{{NewStart: 1, NewLines: 1, Lines: []string{"+x"}}}}); !reflect.DeepEqual(got, []FilePatch{want}) {
+		t.Errorf("ParsePatch(diff -u) = %+v, want %+v", got, want)
+	}
+}
+
+func TestParsePatchErrors(t *testing.T) {
+	tests := []struct {
+		name, patch, want string
+	}{
+		{name: "no file header", patch: "@@ -1 +1 @@\n-a\n+b\n", want: "hunk before the first file header"},
+		{name: "malformed header", patch: "--- a\n+++ b\n@@ -x +1 @@\n", want: "malformed hunk header"},
+		{name: "truncated", patch: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n", want: "truncated"},
+		{name: "unexpected line", patch: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n*b\n", want: "unexpected line"},
+		{name: "too many lines", patch: "--- a\n+++ b\n@@ -1 +1 @@\n-a\n-b\n", want: "more lines than its header says"},
+	}
+	for _, tt := range tests {
+		if _, err := ParsePatch(tt.patch); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: ParsePatch() error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestFilePatchOldText(t *testing.T) {
+	files, _ := ParsePatch(gitPatch)
+	tests := []struct {
+		patch   FilePatch
+		newText string
+		want    string
+		wantErr bool
+	}{
+		{
+			patch:   files[0],
+			newText: "package main\nvar a = accountId\nvar b = userId\n\nfunc f() {\n\tg(accountId)\n}\n",
+			want:    "package main\nvar a = userId\nvar b = userId\n\nfunc f() {\n\tg(userId)\n}\n",
+		},
+		{patch: files[1], newText: "one\ntwo", want: "one\n"},
+		{patch: files[1], newText: "one\ntwo\n", wantErr: true}, // The patch says there is no newline
+		{patch: files[0], newText: "package main\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.patch.OldText(tt.newText)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("OldText(%q) = %q, %v, want %q (error %v)", tt.newText, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPredictFromPatch(t *testing.T) {
+	files, _ := ParsePatch(gitPatch)
+	newText := "package main\nvar a = accountId\nvar b = userId\n\nfunc f() {\n\tg(accountId)\n}\n"
+	got, err := PredictFromPatch(context.Background(), files[0], newText, Options{})
+	if err != nil {
+		t.Fatalf("PredictFromPatch() error = %v", err)
+	}
+	// The same prediction as from the full texts: the rename was made twice
+	want, _ := PredictNextChanges("package main\nvar a = userId\nvar b = userId\n\nfunc f() {\n\tg(userId)\n}\n", newText)
+	if len(got) != 1 || !reflect.DeepEqual(got, want) {
+		t.Errorf("PredictFromPatch() = %+v, want %+v", got, want)
+	}
+
+	if _, err := PredictFromPatch(context.Background(), files[0], "package main\n", Options{}); err == nil {
+		t.Errorf("PredictFromPatch() with a mismatched text: error = nil, want an error")
+	}
+}
@@ -39,3 +39,33 @@ func mapPosition(oldPos int, diffs []diffmatchpatch.Diff) int {
 	// Should ideally not be reached if oldPos is valid, but return currentNewPos as fallback.
 	return currentNewPos
 }
+
+// mapPositionBeforeInsertions is like mapPosition, but when text was inserted exactly at
+// oldPos it returns the position in newText before that insertion rather than after it.
+// This is the right mapping for the start of a range that should include the insertion.
+func mapPositionBeforeInsertions(oldPos int, diffs []diffmatchpatch.Diff) int {
+	currentOldPos := 0
+	currentNewPos := 0
+	for _, diff := range diffs {
+		if currentOldPos >= oldPos {
+			break
+		}
+		diffLen := len(diff.Text)
+		switch diff.Type {
+		case diffmatchpatch.DiffDelete:
+			if oldPos < currentOldPos+diffLen {
+				return currentNewPos
+			}
+			currentOldPos += diffLen
+		case diffmatchpatch.DiffInsert:
+			currentNewPos += diffLen
+		case diffmatchpatch.DiffEqual:
+			if oldPos < currentOldPos+diffLen {
+				return currentNewPos + (oldPos - currentOldPos)
+			}
+			currentOldPos += diffLen
+			currentNewPos += diffLen
+		}
+	}
+	return currentNewPos
+}
@@ -133,3 +133,38 @@ func TestMapPosition(t *testing.T) {
 		})
 	}
 }
+
+func TestMapPositionBeforeInsertions(t *testing.T) {
+	diffs := makeDiffsForPositionMapping([][2]interface{}{
+		{diffmatchpatch.DiffInsert, "s"},
+		{diffmatchpatch.DiffEqual, "log."},
+		{diffmatchpatch.DiffDelete, "Printf"},
+		{diffmatchpatch.DiffInsert, "Info"},
+		{diffmatchpatch.DiffEqual, "(a)"},
+	})
+	tests := []struct {
+		name       string
+		oldPos     int
+		wantNewPos int
+	}{
+		{name: "Insertion at position is excluded", oldPos: 0, wantNewPos: 0},
+		{name: "Inside equal section", oldPos: 2, wantNewPos: 3},
+		{name: "Start of deletion", oldPos: 4, wantNewPos: 5},
+		{name: "Inside deletion", oldPos: 6, wantNewPos: 5},
+		{name: "Replacement text inserted at position is excluded", oldPos: 10, wantNewPos: 5},
+		{name: "After replacement", oldPos: 11, wantNewPos: 10},
+		{name: "End of text", oldPos: 13, wantNewPos: 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapPositionBeforeInsertions(tt.oldPos, diffs); got != tt.wantNewPos {
+				t.Errorf("mapPositionBeforeInsertions(%d, ...) = %d; want %d", tt.oldPos, got, tt.wantNewPos)
+			}
+			if tt.oldPos == 0 {
+				if got := mapPosition(tt.oldPos, diffs); got != 1 {
+					t.Errorf("mapPosition(0, ...) = %d; want 1 (after the insertion)", got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package copre
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// PositionUnit is the unit columns are counted in.
+type PositionUnit int
+
+const (
+	UnitBytes PositionUnit = iota + 1 // Bytes of UTF-8
+	UnitRunes                         // Unicode code points
+	UnitUTF16                         // UTF-16 code units, as used by LSP and JavaScript
+)
+
+// unitNames names the units; the zero value, no unit, is written as nothing.
+var unitNames = map[PositionUnit]string{0: "", UnitBytes: "bytes", UnitRunes: "runes", UnitUTF16: "utf16"}
+
+// MarshalText implements encoding.TextMarshaler, writing "bytes", "runes" or "utf16"
+// (or nothing for the zero value).
+func (u PositionUnit) MarshalText() ([]byte, error) {
+	return marshalEnum(unitNames, u, "position unit")
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (u *PositionUnit) UnmarshalText(text []byte) error {
+	return unmarshalEnum(unitNames, text, "position unit", u)
+}
+
+// Location is a position in a text in several forms.
+type Location struct {
+	Offset int `json:"offset"` // Byte offset
+	Rune   int `json:"rune"`   // Rune offset
+	Line   int `json:"line"`   // Line number (1-based)
+	Column int `json:"column"` // Column (1-based), counted in the unit the Location was computed with
+}
+
+// Range is the span of text between two locations.
+type Range struct {
+	Start Location     `json:"start"`
+	End   Location     `json:"end"`
+	Unit  PositionUnit `json:"unit"` // The unit of the columns
+}
+
+// LineIndex converts between byte offsets and rune offsets or lines and columns in a
+// text. Building it is linear in the text; each conversion then only scans the line the
+// position is on.
+type LineIndex struct {
+	text       string
+	lineStarts []int // Byte offset of the start of each line
+	runeStarts []int // Rune offset of the start of each line
+}
+
+// NewLineIndex indexes the lines of text.
+func NewLineIndex(text string) *LineIndex {
+	x := &LineIndex{text: text, lineStarts: []int{0}, runeStarts: []int{0}}
+	runes := 0
+	for i, r := range text {
+		runes++
+		if r == '\n' {
+			x.lineStarts = append(x.lineStarts, i+1)
+			x.runeStarts = append(x.runeStarts, runes)
+		}
+	}
+	return x
+}
+
+// Location returns the location of the byte offset, clamped to the text, with the
+// column counted in unit.
+func (x *LineIndex) Location(offset int, unit PositionUnit) Location {
+	offset = min(max(offset, 0), len(x.text))
+	line := sort.Search(len(x.lineStarts), func(i int) bool { return x.lineStarts[i] > offset }) - 1
+	prefix := x.text[x.lineStarts[line]:offset]
+	return Location{
+		Offset: offset,
+		Rune:   x.runeStarts[line] + utf8.RuneCountInString(prefix),
+		Line:   line + 1,
+		Column: 1 + unitLen(prefix, unit),
+	}
+}
+
+// Range returns the range between the byte offsets start and end.
+func (x *LineIndex) Range(start, end int, unit PositionUnit) Range {
+	return Range{Start: x.Location(start, unit), End: x.Location(end, unit), Unit: unit}
+}
+
+// Offset returns the byte offset of the 1-based line and column, counted in unit. Lines
+// and columns beyond the text or the line are clamped to its end, and a column inside a
+// character (such as between the two halves of a UTF-16 surrogate pair) resolves to the
+// start of the character.
+func (x *LineIndex) Offset(line, column int, unit PositionUnit) int {
+	if line < 1 {
+		return 0
+	}
+	if line > len(x.lineStarts) {
+		return len(x.text)
+	}
+	start := x.lineStarts[line-1]
+	text := x.text[start:]
+	if end := strings.IndexByte(text, '\n'); end != -1 {
+		text = text[:end]
+	}
+	units := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		next := units + runeUnits(r, size, unit)
+		if next >= column {
+			return start + i
+		}
+		units, i = next, i+size
+	}
+	return start + len(text)
+}
+
+// unitLen returns the length of s counted in unit.
+func unitLen(s string, unit PositionUnit) int {
+	switch unit {
+	case UnitRunes:
+		return utf8.RuneCountInString(s)
+	case UnitUTF16:
+		n := 0
+		for _, r := range s {
+			n += runeUnits(r, 1, UnitUTF16)
+		}
+		return n
+	}
+	return len(s)
+}
+
+// runeUnits returns the number of units r takes, where size is its length in bytes.
+func runeUnits(r rune, size int, unit PositionUnit) int {
+	switch unit {
+	case UnitRunes:
+		return 1
+	case UnitUTF16:
+		if r >= 0x10000 {
+			return 2 // A surrogate pair
+		}
+		return 1
+	}
+	return size
+}
+
+// addRanges sets the Range of each prediction to the text it changes in newText, the
+// text its MappedPosition refers to, sharing one LineIndex among them.
+func addRanges(predictions []PredictedChange, newText string, unit PositionUnit) {
+	if len(predictions) == 0 {
+		return
+	}
+	x := NewLineIndex(newText)
+	for i, p := range predictions {
+		r := x.Range(p.MappedPosition, p.MappedPosition+len(p.TextToRemove), unit)
+		predictions[i].Range = &r
+	}
+}
@@ -0,0 +1,125 @@
+package copre
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestLineIndexLocation(t *testing.T) {
+	// "é" is 2 bytes, 1 rune and 1 UTF-16 unit; "😀" is 4 bytes, 1 rune and 2 UTF-16 units.
+	text := "héllo\n😀 x = 1\n"
+	x := NewLineIndex(text)
+
+	tests := []struct {
+		name   string
+		offset int
+		unit   PositionUnit
+		want   Location
+	}{
+		{"Start", 0, UnitUTF16, Location{Offset: 0, Rune: 0, Line: 1, Column: 1}},
+		{"After two-byte rune in bytes", 3, UnitBytes, Location{Offset: 3, Rune: 2, Line: 1, Column: 4}},
+		{"After two-byte rune in runes", 3, UnitRunes, Location{Offset: 3, Rune: 2, Line: 1, Column: 3}},
+		{"End of first line", 6, UnitRunes, Location{Offset: 6, Rune: 5, Line: 1, Column: 6}},
+		{"Start of second line", 7, UnitUTF16, Location{Offset: 7, Rune: 6, Line: 2, Column: 1}},
+		{"After emoji in bytes", 12, UnitBytes, Location{Offset: 12, Rune: 8, Line: 2, Column: 6}},
+		{"After emoji in runes", 12, UnitRunes, Location{Offset: 12, Rune: 8, Line: 2, Column: 3}},
+		{"After emoji in UTF-16", 12, UnitUTF16, Location{Offset: 12, Rune: 8, Line: 2, Column: 4}},
+		{"End of text", len(text), UnitUTF16, Location{Offset: len(text), Rune: 14, Line: 3, Column: 1}},
+		{"Beyond the text", len(text) + 5, UnitBytes, Location{Offset: len(text), Rune: 14, Line: 3, Column: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := x.Location(tt.offset, tt.unit); got != tt.want {
+				t.Errorf("Location(%d) = %+v, want %+v", tt.offset, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineIndexOffset(t *testing.T) {
+	text := "héllo\n😀 x = 1\n"
+	x := NewLineIndex(text)
+
+	tests := []struct {
+		name   string
+		line   int
+		column int
+		unit   PositionUnit
+		want   int
+	}{
+		{"Start", 1, 1, UnitBytes, 0},
+		{"After two-byte rune in runes", 1, 3, UnitRunes, 3},
+		{"After emoji in UTF-16", 2, 4, UnitUTF16, 12},
+		{"Inside a surrogate pair", 2, 2, UnitUTF16, 7},
+		{"Beyond the line", 1, 99, UnitRunes, 6},
+		{"Beyond the text", 9, 1, UnitBytes, len(text)},
+		{"Before the text", 0, 5, UnitBytes, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := x.Offset(tt.line, tt.column, tt.unit); got != tt.want {
+				t.Errorf("Offset(%d, %d) = %d, want %d", tt.line, tt.column, got, tt.want)
+			}
+		})
+	}
+
+	// Every rune boundary survives a round trip in every unit.
+	for _, unit := range []PositionUnit{UnitBytes, UnitRunes, UnitUTF16} {
+		for offset := range text {
+			loc := x.Location(offset, unit)
+			if got := x.Offset(loc.Line, loc.Column, unit); got != offset {
+				t.Errorf("Offset(Location(%d, %v)) = %d", offset, unit, got)
+			}
+		}
+	}
+}
+
+func TestPositionUnitText(t *testing.T) {
+	for _, unit := range []PositionUnit{0, UnitBytes, UnitRunes, UnitUTF16} {
+		text, err := unit.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText(%d) error = %v", unit, err)
+		}
+		var got PositionUnit
+		if err := got.UnmarshalText(text); err != nil || got != unit {
+			t.Errorf("UnmarshalText(%q) = %d, %v, want %d", text, got, err, unit)
+		}
+	}
+	var u PositionUnit
+	if err := u.UnmarshalText([]byte("chars")); err == nil {
+		t.Errorf("UnmarshalText(chars) succeeded")
+	}
+}
+
+func TestPredictWithRanges(t *testing.T) {
+	// Deleting "😀." on line 1 predicts deleting it on line 2, after a two-byte rune.
+	oldText := "😀.a\né😀.b\n"
+	newText := "a\né😀.b\n"
+	got, err := PredictWithOptions(context.Background(), oldText, newText, Options{RangeUnit: UnitUTF16})
+	if err != nil || len(got) != 1 {
+		t.Fatalf("PredictWithOptions() = %+v, %v, want one prediction", got, err)
+	}
+	want := &Range{
+		Start: Location{Offset: 4, Rune: 3, Line: 2, Column: 2},
+		End:   Location{Offset: 9, Rune: 5, Line: 2, Column: 5},
+		Unit:  UnitUTF16,
+	}
+	if !reflect.DeepEqual(got[0].Range, want) {
+		t.Errorf("Range = %+v, want %+v", got[0].Range, want)
+	}
+	if data, _ := json.Marshal(got[0].Range); string(data) != `{"start":{"offset":4,"rune":3,"line":2,"column":2},"end":{"offset":9,"rune":5,"line":2,"column":5},"unit":"utf16"}` {
+		t.Errorf("json.Marshal(Range) = %s", data)
+	}
+
+	// The range follows the prediction when it is rebased.
+	rebased := RebasePredictions(got, newText, "// x\n"+newText)
+	want.Start = Location{Offset: 9, Rune: 8, Line: 3, Column: 2}
+	want.End = Location{Offset: 14, Rune: 10, Line: 3, Column: 5}
+	if len(rebased) != 1 || !reflect.DeepEqual(rebased[0].Range, want) {
+		t.Errorf("RebasePredictions() = %+v, want Range %+v", rebased, want)
+	}
+}
@@ -1,20 +1,24 @@
 package copre
 
 import (
-	"log"
+	"strings"
 
 	"github.com/sergi/go-diff/diffmatchpatch"
 )
 
 // generatePredictions creates potential PredictedChange objects based on scored anchors.
 // It maps the anchor position from the old text to the new text and proposes
-// applying the same *type* of change (e.g., deletion) found in the original diff.
-func generatePredictions(newText string, anchors []Anchor, charsAdded, charsRemoved string, diffs []diffmatchpatch.Diff) []PredictedChange {
-	var predictions []PredictedChange
-	log.Printf("DEBUG: Generating predictions. Anchors: %d, CharsAdded: %q, CharsRemoved: %q", len(anchors), charsAdded, charsRemoved)
+// applying the same *type* of change (deletion, insertion or replacement) found in the original diff.
+// With cfg.CaseInsensitive, the text at an anchor may differ from charsRemoved in case;
+// the prediction then removes the text as it is.
+func generatePredictions(newText string, anchors []Anchor, charsAdded, charsRemoved string, diffs []diffmatchpatch.Diff, cfg config) []PredictedChange {
+	predictions := []PredictedChange{}
 
 	if len(charsRemoved) == 0 {
-		return predictions // No deletion predictions if nothing was removed
+		if len(charsAdded) == 0 {
+			return predictions // Nothing was changed, so there is nothing to repeat
+		}
+		return generateInsertionPredictions(newText, anchors, charsAdded, diffs, cfg)
 	}
 
 	for _, anchor := range anchors {
@@ -23,19 +27,58 @@ func generatePredictions(newText string, anchors []Anchor, charsAdded, charsRemo
 
 		// Basic check: Ensure the text to remove actually exists at the mapped position in the new text.
 		// This prevents errors if the mapping is complex or the surrounding context changed drastically.
-		if mappedPos+len(charsRemoved) <= len(newText) && newText[mappedPos:mappedPos+len(charsRemoved)] == charsRemoved {
+		if mappedPos+len(charsRemoved) <= len(newText) && textMatches(newText[mappedPos:mappedPos+len(charsRemoved)], charsRemoved, cfg.CaseInsensitive) {
 			predictions = append(predictions, PredictedChange{
 				Position:       anchor.Position, // Keep original position for reference
-				TextToRemove:   charsRemoved,
+				TextToRemove:   newText[mappedPos : mappedPos+len(charsRemoved)],
+				TextToAdd:      charsAdded,  // Non-empty when the original change was a replacement
 				Line:           anchor.Line, // Line number in oldText
 				Score:          anchor.Score,
 				MappedPosition: mappedPos, // Position in newText
 			})
 		} else {
-			log.Printf("WARN: Skipping prediction at oldPos %d (mapped to %d) because '%s' not found in newText at that location.",
-				anchor.Position, mappedPos, charsRemoved)
+			cfg.trace.reject(anchor.Position, reasonTextNotFound)
+			cfg.logger.Debug("skipping anchor: text not found at mapped position", "stage", "predictions",
+				"pos", anchor.Position, "mappedPos", mappedPos, "text", charsRemoved)
+		}
+	}
+	cfg.logger.Debug("generated predictions", "stage", "predictions", "anchors", len(anchors), "count", len(predictions))
+	return predictions
+}
+
+// textMatches reports whether text is want, ignoring case if foldCase is set.
+func textMatches(text, want string, foldCase bool) bool {
+	if foldCase {
+		return strings.EqualFold(text, want)
+	}
+	return text == want
+}
+
+// generateInsertionPredictions proposes inserting charsAdded at each anchor's mapped
+// position in newText, skipping anchors where the insertion is already present.
+func generateInsertionPredictions(newText string, anchors []Anchor, charsAdded string, diffs []diffmatchpatch.Diff, cfg config) []PredictedChange {
+	predictions := []PredictedChange{}
+	for _, anchor := range anchors {
+		mappedPos := mapPosition(anchor.Position, diffs)
+		if mappedPos < 0 || mappedPos > len(newText) {
+			cfg.trace.reject(anchor.Position, reasonOutOfBounds)
+			cfg.logger.Debug("skipping anchor: mapped position out of bounds", "stage", "predictions", "pos", anchor.Position, "mappedPos", mappedPos)
+			continue
+		}
+		// If the text is already there (on either side), the user has made this edit already.
+		if strings.HasPrefix(newText[mappedPos:], charsAdded) || strings.HasSuffix(newText[:mappedPos], charsAdded) {
+			cfg.trace.reject(anchor.Position, reasonAlreadyInserted)
+			cfg.logger.Debug("skipping anchor: insertion already present", "stage", "predictions", "pos", anchor.Position, "mappedPos", mappedPos)
+			continue
 		}
+		predictions = append(predictions, PredictedChange{
+			Position:       anchor.Position,
+			TextToAdd:      charsAdded,
+			Line:           anchor.Line,
+			Score:          anchor.Score,
+			MappedPosition: mappedPos,
+		})
 	}
-	log.Printf("DEBUG: Generated Predictions: %+v", predictions) // Log predictions including mapped positions
+	cfg.logger.Debug("generated insertion predictions", "stage", "predictions", "anchors", len(anchors), "count", len(predictions))
 	return predictions
 }
@@ -22,7 +22,7 @@ func makeDiffsForPrediction(ops [][2]interface{}) []diffmatchpatch.Diff {
 func TestGeneratePredictions(t *testing.T) {
 	dmp := diffmatchpatch.New()
 	oldTextSimple := "delete me here and delete me there"
-	newTextSimple := " here and  there" // removed "delete me" twice
+	newTextSimple := " here and delete me there" // removed the first "delete me"
 	diffsSimple := dmp.DiffMain(oldTextSimple, newTextSimple, true)
 
 	oldTextMapFail := "delete me here and delete you there"
@@ -33,6 +33,7 @@ func TestGeneratePredictions(t *testing.T) {
 		name         string
 		newText      string
 		anchors      []Anchor
+		charsAdded   string
 		charsRemoved string
 		diffs        []diffmatchpatch.Diff
 		wantPreds    []PredictedChange
@@ -55,14 +56,14 @@ func TestGeneratePredictions(t *testing.T) {
 		},
 		{
 			name:    "Simple valid prediction",
-			newText: newTextSimple, // " here and  there"
+			newText: newTextSimple, // " here and delete me there"
 			anchors: []Anchor{
-				{Position: 20, Score: 7, Line: 1}, // "delete me" at pos 20 in oldText
+				{Position: 19, Score: 7, Line: 1}, // "delete me" at pos 19 in oldText
 			},
 			charsRemoved: "delete me",
 			diffs:        diffsSimple,
 			wantPreds: []PredictedChange{
-				{Position: 20, TextToRemove: "delete me", Line: 1, Score: 7, MappedPosition: 11}, // "delete me" at 0 in old -> maps to "" at 0 in new; "delete me" at 20 -> maps to " there" at 11 in new
+				{Position: 19, TextToRemove: "delete me", Line: 1, Score: 7, MappedPosition: 10}, // "delete me" at 19 in old -> 10 in new, after the first removal
 			},
 		},
 		{
@@ -83,9 +84,11 @@ func TestGeneratePredictions(t *testing.T) {
 				{Position: 7, Score: 6, Line: 1},  // Anchor in old: removeX|removeY|removeZ -> 'r' of removeY
 				{Position: 14, Score: 6, Line: 1}, // Anchor in old: removeXremoveY|removeZ| -> 'r' of removeZ
 			},
+			charsRemoved: "remove",
+			diffs:        dmp.DiffMain("removeXremoveYremoveZ", "removeX removeY removeZ", true),
 			wantPreds: []PredictedChange{
 				{Position: 7, TextToRemove: "remove", Line: 1, Score: 6, MappedPosition: 8},   // Mapped to start of "removeY" in newText
-				{Position: 14, TextToRemove: "remove", Line: 1, Score: 6, MappedPosition: 15}, // Mapped to start of "removeZ" in newText
+				{Position: 14, TextToRemove: "remove", Line: 1, Score: 6, MappedPosition: 16}, // Mapped to start of "removeZ" in newText
 			},
 		},
 		{
@@ -114,6 +117,41 @@ func TestGeneratePredictions(t *testing.T) {
 			}),
 			wantPreds: []PredictedChange{}, // Skipped because mapped position is invalid
 		},
+		{
+			name:    "Replacement prediction",
+			newText: "b := 1\na := 2",
+			anchors: []Anchor{
+				{Position: 7, Score: 8, Line: 2}, // "a" on line 2 of oldText
+			},
+			charsAdded:   "b",
+			charsRemoved: "a",
+			diffs:        dmp.DiffMain("a := 1\na := 2", "b := 1\na := 2", true),
+			wantPreds: []PredictedChange{
+				{Position: 7, TextToRemove: "a", TextToAdd: "b", Line: 2, Score: 8, MappedPosition: 7},
+			},
+		},
+		{
+			name:    "Insertion prediction",
+			newText: "foo(a, ctx)\nbar(a)",
+			anchors: []Anchor{
+				{Position: 12, Score: 8, Line: 2}, // Between "a" and ")" of "bar(a)" in oldText
+			},
+			charsAdded: ", ctx",
+			diffs:      dmp.DiffMain("foo(a)\nbar(a)", "foo(a, ctx)\nbar(a)", true),
+			wantPreds: []PredictedChange{
+				{Position: 12, TextToAdd: ", ctx", Line: 2, Score: 8, MappedPosition: 17},
+			},
+		},
+		{
+			name:    "Insertion skipped (already present)",
+			newText: "foo(a, ctx)\nbar(a, ctx)",
+			anchors: []Anchor{
+				{Position: 12, Score: 8, Line: 2},
+			},
+			charsAdded: ", ctx",
+			diffs:      dmp.DiffMain("foo(a)\nbar(a)", "foo(a, ctx)\nbar(a, ctx)", true),
+			wantPreds:  []PredictedChange{},
+		},
 	}
 
 	// Corrected Unicode Test Case Setup
@@ -124,6 +162,7 @@ func TestGeneratePredictions(t *testing.T) {
 		name         string
 		newText      string
 		anchors      []Anchor
+		charsAdded   string
 		charsRemoved string
 		diffs        []diffmatchpatch.Diff
 		wantPreds    []PredictedChange
@@ -131,20 +170,20 @@ func TestGeneratePredictions(t *testing.T) {
 		name:    "Unicode characters - Prediction Match",
 		newText: newTextUnicode,
 		anchors: []Anchor{
-			{Position: 13, Score: 8, Line: 1}, // Byte position of the ' ' before the second 世界
+			{Position: 14, Score: 8, Line: 1}, // Byte position of the ' ' before the second 世界
 		},
 		charsRemoved: " 世界", // What was actually removed
 		diffs:        diffsUnicode,
 		wantPreds: []PredictedChange{
-			// Anchor pos 13 maps to new pos 7. newText[7:] starts with " 世界"
-			{Position: 13, TextToRemove: " 世界", Line: 1, Score: 8, MappedPosition: 7},
+			// Anchor pos 14 maps to new pos 7. newText[7:] starts with " 世界"
+			{Position: 14, TextToRemove: " 世界", Line: 1, Score: 8, MappedPosition: 7},
 		},
 	}
 	tests = append(tests, unicodeTest) // Add the corrected test
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotPreds := generatePredictions(tt.newText, tt.anchors, tt.charsRemoved, tt.diffs)
+			gotPreds := generatePredictions(tt.newText, tt.anchors, tt.charsAdded, tt.charsRemoved, tt.diffs, newConfig(Options{}))
 			// Sort predictions for stable comparison
 			sort.Slice(gotPreds, func(i, j int) bool {
 				if gotPreds[i].MappedPosition != gotPreds[j].MappedPosition {
@@ -0,0 +1,90 @@
+package copre
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Rebase returns the predictions that are still valid in editedText, the text m maps
+// to, with MappedPosition moved to editedText. Predictions are dropped if the edit
+// touched the text they change (including the accepted prediction itself) or if their
+// TextToRemove is no longer at the mapped position. Position and Line still refer to
+// the old text the predictions were made from; a Range is recomputed for editedText.
+func (m PositionMap) Rebase(predictions []PredictedChange, editedText string) []PredictedChange {
+	edits := extractEdits(m.diffs)
+	var index *LineIndex
+	rebased := []PredictedChange{}
+	for _, p := range predictions {
+		if touchesEdits(p, edits) {
+			continue
+		}
+		pos := m.Map(p.MappedPosition)
+		if end := pos + len(p.TextToRemove); pos < 0 || end > len(editedText) || editedText[pos:end] != p.TextToRemove {
+			continue
+		}
+		p.MappedPosition = pos
+		if p.Range != nil {
+			if index == nil {
+				index = NewLineIndex(editedText)
+			}
+			r := index.Range(pos, pos+len(p.TextToRemove), p.Range.Unit)
+			p.Range = &r
+		}
+		rebased = append(rebased, p)
+	}
+	return rebased
+}
+
+// touchesEdits reports whether the range of p overlaps any of the edits, which are
+// positioned in the same text as p's MappedPosition.
+func touchesEdits(p PredictedChange, edits []Edit) bool {
+	for _, e := range edits {
+		if predictionsOverlap(p, PredictedChange{TextToRemove: e.Removed, MappedPosition: e.OldPos}) {
+			return true
+		}
+	}
+	return false
+}
+
+// RebasePredictions updates predictions made against text, the text their
+// MappedPosition refers to, after text was edited into editedText, e.g. because the user
+// accepted one of them or kept typing. See PositionMap.Rebase for which predictions are
+// kept.
+func RebasePredictions(predictions []PredictedChange, text, editedText string) []PredictedChange {
+	// Character diffs keep the changed regions as small as possible, so fewer predictions
+	// near the edit are dropped
+	diffs := computeDiffs(context.Background(), text, editedText, DiffChars)
+	return PositionMap{diffs: diffs}.Rebase(predictions, editedText)
+}
+
+// RebaseAfterEdit is RebasePredictions for a single edit of text, whose OldPos refers to
+// text. To accept prediction p, the edit is Edit{OldPos: p.MappedPosition, Removed:
+// p.TextToRemove, Added: p.TextToAdd}. It returns an error if the edit does not apply to
+// text.
+func RebaseAfterEdit(predictions []PredictedChange, text string, edit Edit) ([]PredictedChange, error) {
+	if err := checkEdit(text, edit); err != nil {
+		return nil, err
+	}
+	end := edit.OldPos + len(edit.Removed)
+	var diffs []diffmatchpatch.Diff
+	diffs = appendDiff(diffs, diffmatchpatch.DiffEqual, text[:edit.OldPos])
+	diffs = appendDiff(diffs, diffmatchpatch.DiffDelete, edit.Removed)
+	diffs = appendDiff(diffs, diffmatchpatch.DiffInsert, edit.Added)
+	diffs = appendDiff(diffs, diffmatchpatch.DiffEqual, text[end:])
+	editedText := text[:edit.OldPos] + edit.Added + text[end:]
+	return PositionMap{diffs: diffs}.Rebase(predictions, editedText), nil
+}
+
+// checkEdit returns an error if edit, whose OldPos refers to text, does not apply to it.
+func checkEdit(text string, edit Edit) error {
+	end := edit.OldPos + len(edit.Removed)
+	if edit.OldPos < 0 || end > len(text) {
+		return fmt.Errorf("edit at %d-%d is out of bounds (text length %d)", edit.OldPos, end, len(text))
+	}
+	if text[edit.OldPos:end] != edit.Removed {
+		return fmt.Errorf("edit at %d expects %q but text has %q", edit.OldPos, edit.Removed, text[edit.OldPos:end])
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package copre
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRebaseAfterEdit(t *testing.T) {
+	pred := func(pos int, remove, add string) PredictedChange {
+		return PredictedChange{TextToRemove: remove, TextToAdd: add, MappedPosition: pos}
+	}
+
+	tests := []struct {
+		name        string
+		text        string
+		predictions []PredictedChange
+		edit        Edit
+		want        []PredictedChange
+		wantErr     bool
+	}{
+		{
+			name:        "Accepting a prediction shifts the later ones",
+			text:        "a.x b.x c.x",
+			predictions: []PredictedChange{pred(1, ".x", ""), pred(5, ".x", ""), pred(9, ".x", "")},
+			edit:        Edit{OldPos: 1, Removed: ".x"},
+			want:        []PredictedChange{pred(3, ".x", ""), pred(7, ".x", "")},
+		},
+		{
+			name:        "Accepting an insertion",
+			text:        "f(a) f(b)",
+			predictions: []PredictedChange{pred(4, "", ";"), pred(9, "", ";")},
+			edit:        Edit{OldPos: 4, Added: ";"},
+			want:        []PredictedChange{pred(10, "", ";")},
+		},
+		{
+			name:        "Accepting a replacement that keeps the removed text",
+			text:        "x x",
+			predictions: []PredictedChange{pred(0, "x", "xy"), pred(2, "x", "xy")},
+			edit:        Edit{OldPos: 0, Removed: "x", Added: "xy"},
+			want:        []PredictedChange{pred(3, "x", "xy")},
+		},
+		{
+			name:        "Edit inside a prediction's target drops it",
+			text:        "foo(1) foo(2)",
+			predictions: []PredictedChange{pred(7, "foo(2)", "bar(2)")},
+			edit:        Edit{OldPos: 11, Removed: "2", Added: "3"},
+			want:        []PredictedChange{},
+		},
+		{
+			name:        "Edit that does not apply",
+			text:        "abc",
+			predictions: []PredictedChange{pred(0, "a", "")},
+			edit:        Edit{OldPos: 1, Removed: "x"},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RebaseAfterEdit(tt.predictions, tt.text, tt.edit)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RebaseAfterEdit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RebaseAfterEdit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRebasePredictions(t *testing.T) {
+	// The user typed a new first line and changed the second target by hand.
+	text := "a.x\nb.x\nc.x\n"
+	editedText := "// top\na.x\nb.y\nc.x\n"
+	predictions := []PredictedChange{
+		{Position: 1, TextToRemove: ".x", Line: 1, Score: 7, MappedPosition: 1},
+		{Position: 5, TextToRemove: ".x", Line: 2, Score: 6, MappedPosition: 5},
+		{Position: 9, TextToRemove: ".x", Line: 3, Score: 5, MappedPosition: 9},
+	}
+	want := []PredictedChange{
+		{Position: 1, TextToRemove: ".x", Line: 1, Score: 7, MappedPosition: 8},
+		{Position: 9, TextToRemove: ".x", Line: 3, Score: 5, MappedPosition: 16},
+	}
+	if got := RebasePredictions(predictions, text, editedText); !reflect.DeepEqual(got, want) {
+		t.Errorf("RebasePredictions() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPositionMapRebase(t *testing.T) {
+	// Apply a selection of the predictions, then rebase the rest onto the result.
+	text := "a1 a2 a3"
+	predictions := []PredictedChange{
+		{TextToRemove: "a", TextToAdd: "bb", MappedPosition: 0},
+		{TextToRemove: "a", TextToAdd: "bb", MappedPosition: 3},
+		{TextToRemove: "a", TextToAdd: "bb", MappedPosition: 6},
+	}
+	result := ApplyPredictions(text, predictions[:2])
+	if result.Text != "bb1 bb2 a3" {
+		t.Fatalf("ApplyPredictions().Text = %q, want %q", result.Text, "bb1 bb2 a3")
+	}
+	want := []PredictedChange{{TextToRemove: "a", TextToAdd: "bb", MappedPosition: 8}}
+	if got := result.Positions.Rebase(predictions, result.Text); !reflect.DeepEqual(got, want) {
+		t.Errorf("Positions.Rebase() = %+v, want %+v", got, want)
+	}
+}
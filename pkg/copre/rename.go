@@ -0,0 +1,114 @@
+package copre
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// RenameSuggestion groups the predictions that together rename an identifier.
+type RenameSuggestion struct {
+	From    string            `json:"from"`    // The identifier before the rename
+	To      string            `json:"to"`      // The identifier after the rename
+	Changes []PredictedChange `json:"changes"` // The predictions for the rename, as PredictNextChanges returns them
+}
+
+// isIdentifier reports whether s is a whole identifier: identifier runes only, not
+// starting with a digit.
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	first, _ := utf8.DecodeRuneInString(s)
+	if unicode.IsDigit(first) {
+		return false
+	}
+	return strings.IndexFunc(s, func(r rune) bool { return !isIdentRune(r) }) == -1
+}
+
+// identifierAt expands the byte range [start, end) of text to the identifier that
+// contains it, returning the expanded range.
+func identifierAt(text string, start, end int) (int, int) {
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:start])
+		if !isIdentRune(r) {
+			break
+		}
+		start -= size
+	}
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if !isIdentRune(r) {
+			break
+		}
+		end += size
+	}
+	return start, end
+}
+
+// isWholeToken reports whether text[start:end] is not directly preceded or followed by
+// an identifier rune, i.e. it is not part of a longer identifier.
+func isWholeToken(text string, start, end int) bool {
+	if start > 0 {
+		if r, _ := utf8.DecodeLastRuneInString(text[:start]); isIdentRune(r) {
+			return false
+		}
+	}
+	if end < len(text) {
+		if r, _ := utf8.DecodeRuneInString(text[end:]); isIdentRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// detectRename reports whether every edit in group renames one whole identifier to
+// another. Edits may cover only part of the identifiers (the diff of userId -> accountId
+// only replaces "user"), so each edit is expanded to the identifiers around it in both
+// texts. It returns the identifiers and the edits expanded to them.
+func detectRename(oldText, newText string, group []Edit, cfg config) (from, to string, renamed []Edit, ok bool) {
+	for _, e := range group {
+		if e.Removed == "" || e.Added == "" || cfg.done() {
+			return "", "", nil, false
+		}
+		oldStart, oldEnd := identifierAt(oldText, e.OldPos, e.OldPos+len(e.Removed))
+		newStart, newEnd := identifierAt(newText, e.NewPos, e.NewPos+len(e.Added))
+		oldIdent, newIdent := oldText[oldStart:oldEnd], newText[newStart:newEnd]
+		if !isIdentifier(oldIdent) || !isIdentifier(newIdent) {
+			return "", "", nil, false
+		}
+		// The expansion must be the same unchanged text on both sides.
+		if oldText[oldStart:e.OldPos] != newText[newStart:e.NewPos] ||
+			oldText[e.OldPos+len(e.Removed):oldEnd] != newText[e.NewPos+len(e.Added):newEnd] {
+			return "", "", nil, false
+		}
+		if from == "" {
+			from, to = oldIdent, newIdent
+		} else if oldIdent != from || newIdent != to {
+			return "", "", nil, false
+		}
+		renamed = append(renamed, Edit{OldPos: oldStart, NewPos: newStart, Removed: oldIdent, Added: newIdent})
+	}
+	return from, to, renamed, from != ""
+}
+
+// findIdentifierAnchors finds the whole-token occurrences of the identifier renamed by
+// the edits in group, skipping the occurrences already renamed.
+func findIdentifierAnchors(oldText string, group []Edit, cfg config) []Anchor {
+	if len(group) == 0 {
+		return []Anchor{}
+	}
+	return findTokenAnchors(oldText, group[0].Removed, group, cfg)
+}
+
+// generateRenamePredictions proposes renaming each remaining occurrence of the identifier
+// and groups the predictions into a RenameSuggestion.
+func generateRenamePredictions(newText string, anchors []Anchor, from, to string, diffs []diffmatchpatch.Diff, cfg config) *RenameSuggestion {
+	return &RenameSuggestion{
+		From:    from,
+		To:      to,
+		Changes: generatePredictions(newText, anchors, to, from, diffs, cfg),
+	}
+}
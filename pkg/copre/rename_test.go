@@ -0,0 +1,125 @@
+package copre
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggestRename(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		want    *RenameSuggestion
+	}{
+		{
+			name: "Whole-token occurrences only",
+			oldText: "count := 1\n" +
+				"counter := count + 1\n" +
+				"recount(count)",
+			newText: "total := 1\n" +
+				"counter := count + 1\n" +
+				"recount(count)",
+			want: &RenameSuggestion{
+				From: "count",
+				To:   "total",
+				Changes: []PredictedChange{
+					// Score: 5 (base) + 1 (affix " ")
+					{Position: 22, TextToRemove: "count", TextToAdd: "total", Line: 2, Score: 6, MappedPosition: 22},
+					{Position: 40, TextToRemove: "count", TextToAdd: "total", Line: 3, Score: 5, MappedPosition: 40},
+				},
+			},
+		},
+		{
+			name: "Partial diff expanded to identifiers",
+			oldText: "userId = 1\n" +
+				"f(userId, otherUserId)",
+			newText: "accountId = 1\n" +
+				"f(userId, otherUserId)",
+			want: &RenameSuggestion{
+				From: "userId",
+				To:   "accountId",
+				Changes: []PredictedChange{
+					{Position: 13, TextToRemove: "userId", TextToAdd: "accountId", Line: 2, Score: 5, MappedPosition: 16},
+				},
+			},
+		},
+		{
+			name: "Repeated rename boosts remaining occurrences",
+			oldText: "a(x)\n" +
+				"b(x)\n" +
+				"c(x)",
+			newText: "a(y)\n" +
+				"b(y)\n" +
+				"c(x)",
+			want: &RenameSuggestion{
+				From: "x",
+				To:   "y",
+				Changes: []PredictedChange{
+					// Score: 5 (base) + 1 (prefix "(") + 1 (affix ")") + 2 (one repetition)
+					{Position: 12, TextToRemove: "x", TextToAdd: "y", Line: 3, Score: 9, MappedPosition: 12},
+				},
+			},
+		},
+		{
+			// The rename changes the argument on the same line too, so the edit template
+			// replaces the plain rename: the suggestion holds the merged predictions
+			name:    "Merged with the edit template",
+			oldText: "x := foo(a, 1)\ny := foo(b, 1)\n",
+			newText: "x := bar(a, 2)\ny := foo(b, 1)\n",
+			want: &RenameSuggestion{
+				From: "foo",
+				To:   "bar",
+				Changes: []PredictedChange{
+					{Position: 20, TextToRemove: "foo(b, 1)", TextToAdd: "bar(b, 2)", Line: 2, Score: 9, MappedPosition: 20},
+				},
+			},
+		},
+		{
+			name:    "Not a rename: part of an identifier changes into punctuation",
+			oldText: "foo_bar(a)",
+			newText: "foo.bar(a)",
+			want:    nil,
+		},
+		{
+			name:    "Not a rename: deletion",
+			oldText: "a b a",
+			newText: "a a",
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SuggestRename(tt.oldText, tt.newText)
+			if err != nil {
+				t.Fatalf("SuggestRename() error = %v", err)
+			}
+			if got != nil {
+				sortPredictions(got.Changes)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SuggestRename() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsWholeToken(t *testing.T) {
+	tests := []struct {
+		text       string
+		start, end int
+		want       bool
+	}{
+		{text: "count", start: 0, end: 5, want: true},
+		{text: "(count)", start: 1, end: 6, want: true},
+		{text: "counter", start: 0, end: 5, want: false},
+		{text: "recount", start: 2, end: 7, want: false},
+		{text: "größe", start: 0, end: 2, want: false}, // "gr" followed by "ö"
+	}
+	for _, tt := range tests {
+		if got := isWholeToken(tt.text, tt.start, tt.end); got != tt.want {
+			t.Errorf("isWholeToken(%q, %d, %d) = %v, want %v", tt.text, tt.start, tt.end, got, tt.want)
+		}
+	}
+}
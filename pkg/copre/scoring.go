@@ -0,0 +1,164 @@
+package copre
+
+import (
+	"sort"
+	"strings"
+)
+
+// Site is a place in the old text where a change was made or could be repeated, together
+// with its context.
+type Site struct {
+	Text     string // The whole old text
+	Position int    // Byte offset of the site in Text
+	Length   int    // Byte length of the text the change replaces at the site (0 for insertions)
+	Line     int    // Line number of the site in Text (1-based)
+	Prefix   string // Text before the site on the same line
+	Affix    string // Text after the replaced text on the same line
+
+	lines []string // Text split at newlines, shared by the Sites of one siteText
+}
+
+// textLines returns the lines of s.Text, splitting it only for a Site built outside a
+// siteText.
+func (s Site) textLines() []string {
+	if s.lines == nil {
+		return strings.Split(s.Text, "\n")
+	}
+	return s.lines
+}
+
+// siteText is a text to make Sites in. It is split into lines once for all its Sites, so
+// that scorers comparing whole lines do not split it again for every candidate.
+type siteText struct {
+	text       string
+	lines      []string
+	lineStarts []int // Byte offset of each line
+}
+
+// newSiteText splits text into lines for making Sites in it.
+func newSiteText(text string) *siteText {
+	t := &siteText{text: text, lines: strings.Split(text, "\n")}
+	t.lineStarts = make([]int, len(t.lines))
+	for i := 1; i < len(t.lines); i++ {
+		t.lineStarts[i] = t.lineStarts[i-1] + len(t.lines[i-1]) + 1
+	}
+	return t
+}
+
+// site returns the Site of the length bytes at pos in the text.
+func (t *siteText) site(pos, length int) Site {
+	prefix, affix := getLocalContext(t.text, pos, length)
+	return Site{
+		Text:     t.text,
+		Position: pos,
+		Length:   length,
+		Line:     sort.Search(len(t.lineStarts), func(i int) bool { return t.lineStarts[i] > pos }),
+		Prefix:   prefix,
+		Affix:    affix,
+		lines:    t.lines,
+	}
+}
+
+// newSite returns the Site of the length bytes at pos in text. Use a siteText to make
+// several Sites in the same text.
+func newSite(text string, pos, length int) Site {
+	return newSiteText(text).site(pos, length)
+}
+
+// ScoreComponent is the number of points one piece of evidence contributed to a Score.
+type ScoreComponent struct {
+	Name   string `json:"name"`
+	Points int    `json:"points"`
+}
+
+// Score is the result of scoring a candidate site: the total and how it was arrived at.
+type Score struct {
+	Total     int              `json:"total"`
+	Breakdown []ScoreComponent `json:"breakdown"`
+}
+
+// Scorer scores how likely the change made at the original site is to be repeated at a
+// candidate site. Higher scores are more likely.
+type Scorer interface {
+	Score(original, candidate Site) Score
+}
+
+// LocalContextScorer is the default Scorer: a base score plus the number of bytes of
+// same-line context before and after the candidate that match the original's.
+type LocalContextScorer struct {
+	Width int // If positive, only this many runes of context on each side are compared
+}
+
+// Score implements Scorer.
+func (s LocalContextScorer) Score(original, candidate Site) Score {
+	prefix := commonSuffixLen(s.trimPrefix(original.Prefix), s.trimPrefix(candidate.Prefix))
+	affix := commonPrefixLen(s.trimAffix(original.Affix), s.trimAffix(candidate.Affix))
+	return Score{
+		Total: baseScore + prefix + affix,
+		Breakdown: []ScoreComponent{
+			{Name: "base", Points: baseScore},
+			{Name: "prefix", Points: prefix},
+			{Name: "affix", Points: affix},
+		},
+	}
+}
+
+// trimPrefix returns the last Width runes of prefix.
+func (s LocalContextScorer) trimPrefix(prefix string) string {
+	if runes := []rune(prefix); s.Width > 0 && len(runes) > s.Width {
+		return string(runes[len(runes)-s.Width:])
+	}
+	return prefix
+}
+
+// trimAffix returns the first Width runes of affix.
+func (s LocalContextScorer) trimAffix(affix string) string {
+	if runes := []rune(affix); s.Width > 0 && len(runes) > s.Width {
+		return string(runes[:s.Width])
+	}
+	return affix
+}
+
+// DefaultScorer returns the Scorer used when none is configured.
+func DefaultScorer() Scorer {
+	return LocalContextScorer{}
+}
+
+// WeightedScorer is a Scorer whose score is multiplied by Weight when combined.
+type WeightedScorer struct {
+	Scorer Scorer
+	Weight int
+}
+
+// Combine returns a Scorer that scores a candidate with the weighted sum of the scores of
+// scorers. Its breakdown lists the weighted components of each scorer in order.
+func Combine(scorers ...WeightedScorer) Scorer {
+	return combinedScorer(scorers)
+}
+
+type combinedScorer []WeightedScorer
+
+// Score implements Scorer.
+func (c combinedScorer) Score(original, candidate Site) Score {
+	var total Score
+	for _, ws := range c {
+		s := ws.Scorer.Score(original, candidate)
+		total.Total += ws.Weight * s.Total
+		for _, component := range s.Breakdown {
+			component.Points *= ws.Weight
+			total.Breakdown = append(total.Breakdown, component)
+		}
+	}
+	return total
+}
+
+// bestScore scores candidate against each of the original sites and returns the best.
+func bestScore(scorer Scorer, originals []Site, candidate Site) Score {
+	var best Score
+	for i, original := range originals {
+		if s := scorer.Score(original, candidate); i == 0 || s.Total > best.Total {
+			best = s
+		}
+	}
+	return best
+}
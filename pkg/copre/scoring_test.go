@@ -0,0 +1,79 @@
+package copre
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLocalContextScorer(t *testing.T) {
+	text := "a.foo(x)\nb.foo(x)\nc.foo(y)"
+	original := newSite(text, 2, 3)
+
+	tests := []struct {
+		name      string
+		candidate Site
+		want      Score
+	}{
+		{
+			name:      "Matching prefix and affix",
+			candidate: newSite(text, 11, 3),
+			want: Score{Total: 5 + 1 + 3, Breakdown: []ScoreComponent{
+				{Name: "base", Points: 5}, {Name: "prefix", Points: 1}, {Name: "affix", Points: 3},
+			}},
+		},
+		{
+			name:      "Partially matching affix",
+			candidate: newSite(text, 20, 3),
+			want: Score{Total: 5 + 1 + 1, Breakdown: []ScoreComponent{
+				{Name: "base", Points: 5}, {Name: "prefix", Points: 1}, {Name: "affix", Points: 1},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (LocalContextScorer{}).Score(original, tt.candidate); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Score() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// lineScorer scores candidates by their line number, preferring later lines.
+type lineScorer struct{}
+
+func (lineScorer) Score(original, candidate Site) Score {
+	return Score{Total: candidate.Line, Breakdown: []ScoreComponent{{Name: "line", Points: candidate.Line}}}
+}
+
+func TestCombine(t *testing.T) {
+	text := "a.foo(x)\nb.foo(x)"
+	scorer := Combine(
+		WeightedScorer{Scorer: LocalContextScorer{}, Weight: 1},
+		WeightedScorer{Scorer: lineScorer{}, Weight: 10},
+	)
+	got := scorer.Score(newSite(text, 2, 3), newSite(text, 11, 3))
+	want := Score{Total: 9 + 20, Breakdown: []ScoreComponent{
+		{Name: "base", Points: 5}, {Name: "prefix", Points: 1}, {Name: "affix", Points: 3},
+		{Name: "line", Points: 20},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Score() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPredictWithScorer(t *testing.T) {
+	oldText := "a-x\nb-x\nc-x"
+	newText := "a\nb-x\nc-x"
+	got, err := PredictWithScorer(oldText, newText, lineScorer{})
+	if err != nil {
+		t.Fatalf("PredictWithScorer() error = %v", err)
+	}
+	sortPredictions(got)
+	want := []PredictedChange{
+		{Position: 5, TextToRemove: "-x", Line: 2, Score: 2, MappedPosition: 3},
+		{Position: 9, TextToRemove: "-x", Line: 3, Score: 3, MappedPosition: 7},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PredictWithScorer() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,113 @@
+package copre
+
+import (
+	"context"
+	"sync"
+)
+
+// Session tracks a document through a stream of edits and predicts the next change
+// from the whole trajectory rather than from a single old/new pair.
+//
+// Predictions are computed between the text the session started from (the base) and
+// the current text, so every edit made during the session counts as evidence: once the
+// user has made the same deletion three times, the remaining sites are boosted
+// accordingly. Predictions are recomputed after every edit, so predictions the user has
+// since carried out, or whose target text has changed, are dropped.
+//
+// In the returned predictions, Position and Line refer to the base text and
+// MappedPosition refers to the current text. A Session is safe for concurrent use.
+type Session struct {
+	mu          sync.Mutex
+	base        string
+	current     string
+	history     []Edit
+	predictions []PredictedChange
+	opts        Options
+}
+
+// NewSession starts a session on the given text.
+func NewSession(text string) *Session {
+	return NewSessionWithOptions(text, Options{})
+}
+
+// NewSessionWithOptions starts a session on the given text that predicts with opts. If
+// a prediction is truncated (see Options.Timeout), Update and Apply return the partial
+// predictions together with the error.
+func NewSessionWithOptions(text string, opts Options) *Session {
+	return &Session{base: text, current: text, predictions: []PredictedChange{}, opts: opts}
+}
+
+// Update records a new version of the text, appending the edits that turn the
+// previous version into it to the history, and returns the updated predictions.
+func (s *Session) Update(newText string) ([]PredictedChange, error) {
+	return s.UpdateContext(context.Background(), newText)
+}
+
+// UpdateContext is Update with the prediction bounded by ctx as well as Options.Timeout,
+// as for PredictWithOptions. The new version is recorded even if ctx is done, in which
+// case the predictions are partial and the error wraps ErrTruncated.
+func (s *Session) UpdateContext(ctx context.Context, newText string) ([]PredictedChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	diffs := computeDiffs(ctx, s.current, newText, DiffSemantic)
+	s.history = append(s.history, extractEdits(diffs)...)
+	s.current = newText
+	return s.repredict(ctx)
+}
+
+// Apply applies a single edit to the current text and returns the updated predictions.
+// The edit's OldPos refers to the current text, and Removed must match the text there.
+func (s *Session) Apply(edit Edit) ([]PredictedChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := checkEdit(s.current, edit); err != nil {
+		return nil, err
+	}
+	end := edit.OldPos + len(edit.Removed)
+
+	edit.NewPos = edit.OldPos
+	s.history = append(s.history, edit)
+	s.current = s.current[:edit.OldPos] + edit.Added + s.current[end:]
+	return s.repredict(context.Background())
+}
+
+// repredict recomputes the predictions from the base text to the current text, bounded
+// by ctx. The caller must hold s.mu.
+func (s *Session) repredict(ctx context.Context) ([]PredictedChange, error) {
+	cfg, cancel := startConfig(ctx, s.opts)
+	defer cancel()
+	result := predict(s.base, s.current, cfg)
+	s.predictions = result.predictions
+	return s.predictions, result.err
+}
+
+// Text returns the current text.
+func (s *Session) Text() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// Base returns the text the session started from.
+func (s *Session) Base() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.base
+}
+
+// History returns the edits applied so far, in order. Each edit's positions refer to
+// the version of the text it was applied to.
+func (s *Session) History() []Edit {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Edit(nil), s.history...)
+}
+
+// Predictions returns the predictions for the current text.
+func (s *Session) Predictions() []PredictedChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]PredictedChange{}, s.predictions...)
+}
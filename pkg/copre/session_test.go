@@ -0,0 +1,163 @@
+package copre
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSessionTrajectory(t *testing.T) {
+	base := "alpha-x\n" +
+		"beta-x\n" +
+		"gamma-x\n" +
+		"delta-x"
+	s := NewSession(base)
+
+	// First deletion: every other site is predicted with the base score.
+	got, err := s.Update("alpha\n" +
+		"beta-x\n" +
+		"gamma-x\n" +
+		"delta-x")
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	sortPredictions(got)
+	want := []PredictedChange{
+		{Position: 12, TextToRemove: "-x", Line: 2, Score: 6, MappedPosition: 10},
+		{Position: 20, TextToRemove: "-x", Line: 3, Score: 6, MappedPosition: 18},
+		{Position: 28, TextToRemove: "-x", Line: 4, Score: 6, MappedPosition: 26},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("after first edit got %+v, want %+v", got, want)
+	}
+
+	// Second and third deletions: the remaining site is boosted by both repetitions,
+	// and the sites the user already edited are no longer predicted.
+	if _, err := s.Update("alpha\n" +
+		"beta\n" +
+		"gamma-x\n" +
+		"delta-x"); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	got, err = s.Apply(Edit{OldPos: 16, Removed: "-x"})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	want = []PredictedChange{
+		// 5 (base) + 2 (prefix "ta", from "beta") + 2*2 (two repetitions)
+		{Position: 28, TextToRemove: "-x", Line: 4, Score: 11, MappedPosition: 22},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("after third edit got %+v, want %+v", got, want)
+	}
+	if !reflect.DeepEqual(s.Predictions(), want) {
+		t.Errorf("Predictions() = %+v, want %+v", s.Predictions(), want)
+	}
+
+	wantHistory := []Edit{
+		{OldPos: 5, NewPos: 5, Removed: "-x"},
+		{OldPos: 10, NewPos: 10, Removed: "-x"},
+		{OldPos: 16, NewPos: 16, Removed: "-x"},
+	}
+	if !reflect.DeepEqual(s.History(), wantHistory) {
+		t.Errorf("History() = %+v, want %+v", s.History(), wantHistory)
+	}
+	if s.Base() != base {
+		t.Errorf("Base() = %q, want %q", s.Base(), base)
+	}
+}
+
+func TestSessionDropsStalePredictions(t *testing.T) {
+	s := NewSession("alpha-x\n" +
+		"beta-x\n" +
+		"gamma-x")
+	if _, err := s.Update("alpha\n" +
+		"beta-x\n" +
+		"gamma-x"); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	// The user rewrites the target on line 3, so only line 2 is still a valid site.
+	got, err := s.Update("alpha\n" +
+		"beta-x\n" +
+		"gamma-y")
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	for _, p := range got {
+		if p.Line == 3 {
+			t.Errorf("prediction on rewritten line 3 was not dropped: %+v", p)
+		}
+	}
+	if len(got) != 1 || got[0].Line != 2 {
+		t.Errorf("Update() = %+v, want a single prediction on line 2", got)
+	}
+
+	// Carrying out the remaining prediction leaves nothing to predict for "-x".
+	got, err = s.Apply(Edit{OldPos: 10, Removed: "-x"})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	for _, p := range got {
+		if p.TextToRemove == "-x" {
+			t.Errorf("satisfied prediction was not dropped: %+v", p)
+		}
+	}
+	if s.Text() != "alpha\nbeta\ngamma-y" {
+		t.Errorf("Text() = %q", s.Text())
+	}
+}
+
+func TestSessionApplyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		edit Edit
+	}{
+		{name: "Out of bounds", edit: Edit{OldPos: 10, Removed: "x"}},
+		{name: "Negative position", edit: Edit{OldPos: -1, Added: "x"}},
+		{name: "Removed text mismatch", edit: Edit{OldPos: 0, Removed: "xyz"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSession("abc")
+			if _, err := s.Apply(tt.edit); err == nil {
+				t.Errorf("Apply(%+v) expected an error", tt.edit)
+			}
+			if s.Text() != "abc" || len(s.History()) != 0 {
+				t.Errorf("failed Apply changed the session: text %q, history %+v", s.Text(), s.History())
+			}
+		})
+	}
+}
+
+func TestSessionWithOptions(t *testing.T) {
+	s := NewSessionWithOptions("a-x\nb-x\nc-x", Options{MaxResults: 1, RangeUnit: UnitRunes})
+	got, err := s.Update("a\nb-x\nc-x")
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Range == nil || got[0].Range.Start.Line != 2 {
+		t.Errorf("Update() = %+v, want one prediction with a range on line 2", got)
+	}
+}
+
+func TestSessionUpdateContext(t *testing.T) {
+	s := NewSession("alpha-x\nbeta-x\ngamma-x")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	got, err := s.UpdateContext(ctx, "alpha\nbeta-x\ngamma-x")
+	if !errors.Is(err, ErrTruncated) || !errors.Is(err, context.Canceled) {
+		t.Errorf("UpdateContext() error = %v, want ErrTruncated and %v", err, context.Canceled)
+	}
+	if len(got) != 0 {
+		t.Errorf("UpdateContext() = %+v, want no predictions", got)
+	}
+	// The version is recorded all the same, and the next update predicts from it
+	if got := s.Text(); got != "alpha\nbeta-x\ngamma-x" {
+		t.Errorf("Text() = %q, want the new version", got)
+	}
+	if got, err := s.UpdateContext(context.Background(), "alpha\nbeta\ngamma-x"); err != nil || len(got) != 1 {
+		t.Errorf("UpdateContext() = %+v, %v, want one prediction", got, err)
+	}
+}
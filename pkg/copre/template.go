@@ -0,0 +1,435 @@
+package copre
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// tokenKind classifies the tokens produced by tokenize.
+type tokenKind int
+
+const (
+	tokenIdent  tokenKind = iota // Identifier or keyword
+	tokenNumber                  // Numeric literal
+	tokenString                  // Quoted string or rune literal
+	tokenPunct                   // Any other single rune
+)
+
+// token is a lexical token of a text with its byte range and 0-based line number.
+type token struct {
+	text       string
+	kind       tokenKind
+	start, end int
+	line       int
+}
+
+// tokenize splits text into identifiers, numbers, quoted literals and single-rune
+// punctuation, skipping whitespace. It is language-agnostic on purpose: it only needs
+// to be good enough to tell call sites and their arguments apart.
+func tokenize(text string) []token {
+	var tokens []token
+	line := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case r == '\n':
+			line++
+			i += size
+		case unicode.IsSpace(r):
+			i += size
+		case isIdentRune(r):
+			end := i + len(leadingToken(text[i:]))
+			kind := tokenIdent
+			if unicode.IsDigit(r) {
+				kind = tokenNumber
+			}
+			tokens = append(tokens, token{text: text[i:end], kind: kind, start: i, end: end, line: line})
+			i = end
+		case r == '"' || r == '\'' || r == '`':
+			end := scanQuoted(text, i)
+			tokens = append(tokens, token{text: text[i:end], kind: tokenString, start: i, end: end, line: line})
+			line += strings.Count(text[i:end], "\n")
+			i = end
+		default:
+			tokens = append(tokens, token{text: text[i : i+size], kind: tokenPunct, start: i, end: i + size, line: line})
+			i += size
+		}
+	}
+	return tokens
+}
+
+// scanQuoted returns the end of the quoted literal starting at text[start]. Literals
+// quoted with " or ' end at the matching unescaped quote or at the end of the line;
+// backtick literals may span lines.
+func scanQuoted(text string, start int) int {
+	quote := text[start]
+	for i := start + 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			if quote != '`' {
+				i++ // Skip the escaped byte
+			}
+		case '\n':
+			if quote != '`' {
+				return i
+			}
+		case quote:
+			return i + 1
+		}
+	}
+	return len(text)
+}
+
+// bracketDelta returns +1 for an opening bracket, -1 for a closing one and 0 otherwise.
+// Braces are deliberately not treated as brackets so templates never grow into blocks.
+func bracketDelta(t token) int {
+	switch t.text {
+	case "(", "[":
+		return 1
+	case ")", "]":
+		return -1
+	}
+	return 0
+}
+
+// maxTemplateTokens bounds the size of a template region and of a single hole capture.
+const maxTemplateTokens = 64
+
+// templateToken is one element of an edit template: a literal token or, when hole is
+// non-negative, a placeholder that captures a balanced run of tokens.
+type templateToken struct {
+	text string
+	hole int
+}
+
+// editTemplate is a generalized form of an observed edit. Tokens of the edited region
+// that also appear in the new text and sit inside brackets (arguments, indices) are
+// replaced by holes, so the template matches the same edit applied to other values.
+type editTemplate struct {
+	pattern     []templateToken
+	replacement string   // New region text, with hole tokens cut out
+	holeOffsets []int    // Offset into replacement where each hole reference goes, ascending
+	holeRefs    []int    // Hole index for each offset in holeOffsets
+	holeNames   []string // Original text of each hole, for logging
+	oldStart    int      // Byte range of the original region in oldText
+	oldEnd      int
+	hunks       int // Number of diff hunks inside the region
+}
+
+// String renders the template with holes shown as $1, $2, ...
+func (t *editTemplate) String() string {
+	var parts []string
+	for _, tt := range t.pattern {
+		if tt.hole >= 0 {
+			parts = append(parts, fmt.Sprintf("$%d", tt.hole+1))
+		} else {
+			parts = append(parts, tt.text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// buildEditTemplate generalizes the edit seed (one of edits) into a template. The region
+// around the seed is grown to whole tokens, to every hunk on the same lines, and to
+// balanced brackets including the callee in front of an argument list. It returns nil if
+// no region can be formed or if the region has no holes, in which case the template
+// would not match anything exact matching does not already find.
+func buildEditTemplate(oldText, newText string, edits []Edit, seed Edit, diffs []diffmatchpatch.Diff, cfg config) *editTemplate {
+	tokens := tokenize(oldText)
+	startTok, endTok, hunks, ok := templateRegion(oldText, tokens, edits, seed, cfg)
+	if !ok {
+		return nil
+	}
+	oldStart, oldEnd := tokens[startTok].start, tokens[endTok-1].end
+	newStart, newEnd := mapPositionBeforeInsertions(oldStart, diffs), mapPosition(oldEnd, diffs)
+	if newStart > newEnd || newEnd > len(newText) {
+		return nil
+	}
+	newRegion := newText[newStart:newEnd]
+
+	newTokens := tokenize(newRegion)
+	inNew := make(map[string]bool, len(newTokens))
+	for _, t := range newTokens {
+		inNew[t.text] = true
+	}
+
+	// Arguments carried over from the old region to the new one become holes.
+	tmpl := &editTemplate{oldStart: oldStart, oldEnd: oldEnd, hunks: hunks}
+	holes := make(map[string]int)
+	depth := 0
+	for _, t := range tokens[startTok:endTok] {
+		hole := -1
+		if depth > 0 && t.kind != tokenPunct && inNew[t.text] {
+			i, ok := holes[t.text]
+			if !ok {
+				i = len(holes)
+				holes[t.text] = i
+				tmpl.holeNames = append(tmpl.holeNames, t.text)
+			}
+			hole = i
+		}
+		tmpl.pattern = append(tmpl.pattern, templateToken{text: t.text, hole: hole})
+		depth += bracketDelta(t)
+	}
+	if len(holes) == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, t := range newTokens {
+		i, ok := holes[t.text]
+		if !ok {
+			continue
+		}
+		b.WriteString(newRegion[last:t.start])
+		tmpl.holeOffsets = append(tmpl.holeOffsets, b.Len())
+		tmpl.holeRefs = append(tmpl.holeRefs, i)
+		last = t.end
+	}
+	b.WriteString(newRegion[last:])
+	tmpl.replacement = b.String()
+	return tmpl
+}
+
+// templateRegion computes the token range [startTok, endTok) of the region around seed,
+// and the number of hunks it contains. See buildEditTemplate.
+func templateRegion(oldText string, tokens []token, edits []Edit, seed Edit, cfg config) (startTok, endTok, hunks int, ok bool) {
+	if len(tokens) == 0 {
+		return 0, 0, 0, false
+	}
+	a, b := seed.OldPos, seed.OldPos+len(seed.Removed)
+	for iteration := 0; iteration < 8; iteration++ {
+		if cfg.done() {
+			return 0, 0, 0, false
+		}
+		// Take in every hunk on the lines the region covers.
+		lineStart := strings.LastIndexByte(oldText[:a], '\n') + 1
+		lineEnd := strings.IndexByte(oldText[b:], '\n')
+		if lineEnd == -1 {
+			lineEnd = len(oldText)
+		} else {
+			lineEnd += b
+		}
+		hunks = 0
+		for _, e := range edits {
+			if e.OldPos >= lineStart && e.OldPos <= lineEnd {
+				hunks++
+				a = min(a, e.OldPos)
+				b = max(b, e.OldPos+len(e.Removed))
+			}
+		}
+
+		// Grow to whole tokens, including tokens that touch the region on either side.
+		lineA, lineB := strings.Count(oldText[:a], "\n"), strings.Count(oldText[:b], "\n")
+		startTok, endTok = -1, -1
+		for i, t := range tokens {
+			overlaps := t.start < b && t.end > a
+			touches := t.end == a && t.line == lineA || t.start == b && t.line == lineB
+			if overlaps || touches {
+				if startTok == -1 {
+					startTok = i
+				}
+				endTok = i + 1
+			}
+		}
+		if startTok == -1 {
+			return 0, 0, 0, false
+		}
+
+		// Balance brackets by extending to the matching opening/closing bracket.
+		depth := 0
+		for i := startTok; i < endTok; i++ {
+			depth += bracketDelta(tokens[i])
+			for depth < 0 && startTok > 0 {
+				startTok--
+				depth += bracketDelta(tokens[startTok])
+			}
+			if depth < 0 {
+				return 0, 0, 0, false
+			}
+		}
+		for depth > 0 && endTok < len(tokens) {
+			depth += bracketDelta(tokens[endTok])
+			endTok++
+		}
+		if depth != 0 {
+			return 0, 0, 0, false
+		}
+
+		// An argument list belongs with the callee directly in front of it.
+		if bracketDelta(tokens[startTok]) > 0 {
+			for startTok > 0 && tokens[startTok-1].end == tokens[startTok].start &&
+				(tokens[startTok-1].kind == tokenIdent || tokens[startTok-1].text == ".") {
+				startTok--
+			}
+		}
+		if endTok-startTok > maxTemplateTokens {
+			return 0, 0, 0, false
+		}
+
+		newA, newB := tokens[startTok].start, tokens[endTok-1].end
+		if newA == a && newB == b {
+			return startTok, endTok, hunks, true
+		}
+		a, b = min(a, newA), max(b, newB)
+	}
+	return startTok, endTok, hunks, true
+}
+
+// match tries to match the template against tokens starting at index si. It returns
+// the index just past the matched tokens and the text captured by each hole.
+func (t *editTemplate) match(text string, tokens []token, si int) (int, []string, bool) {
+	captures := make([]string, len(t.holeNames))
+	end, ok := t.matchFrom(text, tokens, 0, si, captures)
+	return end, captures, ok
+}
+
+func (t *editTemplate) matchFrom(text string, tokens []token, ti, si int, captures []string) (int, bool) {
+	if ti == len(t.pattern) {
+		return si, true
+	}
+	p := t.pattern[ti]
+	if p.hole < 0 {
+		if si < len(tokens) && tokens[si].text == p.text {
+			return t.matchFrom(text, tokens, ti+1, si+1, captures)
+		}
+		return 0, false
+	}
+
+	// A hole captures a non-empty, bracket-balanced run of tokens.
+	depth := 0
+	for e := si; e < len(tokens) && e-si < maxTemplateTokens; e++ {
+		depth += bracketDelta(tokens[e])
+		if depth < 0 {
+			break
+		}
+		if depth > 0 {
+			continue
+		}
+		captured := text[tokens[si].start:tokens[e].end]
+		previous := captures[p.hole]
+		if previous != "" && previous != captured {
+			continue
+		}
+		captures[p.hole] = captured
+		if end, ok := t.matchFrom(text, tokens, ti+1, e+1, captures); ok {
+			return end, true
+		}
+		captures[p.hole] = previous
+	}
+	return 0, false
+}
+
+// instantiate fills the template's replacement with captured hole values.
+func (t *editTemplate) instantiate(captures []string) string {
+	var b strings.Builder
+	last := 0
+	for i, offset := range t.holeOffsets {
+		b.WriteString(t.replacement[last:offset])
+		b.WriteString(captures[t.holeRefs[i]])
+		last = offset
+	}
+	b.WriteString(t.replacement[last:])
+	return b.String()
+}
+
+// generateTemplatePredictions matches the template against oldText and proposes
+// replacing each matching site with the template instantiated for that site. Sites that
+// overlap any edit the user has already made are skipped.
+func generateTemplatePredictions(oldText, newText string, tmpl *editTemplate, edits []Edit, diffs []diffmatchpatch.Diff, cfg config) []PredictedChange {
+	predictions := []PredictedChange{}
+	if tmpl == nil {
+		return predictions
+	}
+	sites := newSiteText(oldText)
+	original := sites.site(tmpl.oldStart, tmpl.oldEnd-tmpl.oldStart)
+
+	tokens := tokenize(oldText)
+	for si := 0; si < len(tokens) && !cfg.done(); si++ {
+		end, captures, ok := tmpl.match(oldText, tokens, si)
+		if !ok {
+			continue
+		}
+		siteStart, siteEnd := tokens[si].start, tokens[end-1].end
+		site := sites.site(siteStart, siteEnd-siteStart)
+		if overlapsEdits(siteStart, siteEnd, edits) {
+			cfg.trace.rejectCandidate("template", site, func() Score { return cfg.scorer.Score(original, site) }, reasonAlreadyEdited)
+			continue
+		}
+		score := cfg.scorer.Score(original, site)
+		cfg.trace.addCandidate("template", site, score)
+
+		siteText := oldText[siteStart:siteEnd]
+		mappedPos := mapPosition(siteStart, diffs)
+		if mappedPos+len(siteText) > len(newText) || newText[mappedPos:mappedPos+len(siteText)] != siteText {
+			cfg.trace.reject(siteStart, reasonTextNotFound, "template")
+			cfg.logger.Debug("skipping template match: text not found at mapped position", "stage", "template",
+				"pos", siteStart, "mappedPos", mappedPos, "text", siteText)
+			continue
+		}
+
+		predictions = append(predictions, PredictedChange{
+			Position:       siteStart,
+			TextToRemove:   siteText,
+			TextToAdd:      tmpl.instantiate(captures),
+			Line:           site.Line,
+			Score:          score.Total,
+			MappedPosition: mappedPos,
+		})
+		si = end - 1 // Continue after the match; sites do not overlap
+	}
+	cfg.logger.Debug("generated template predictions", "stage", "template", "count", len(predictions))
+	return predictions
+}
+
+// overlapsEdits reports whether the byte range [start, end) of the old text touches
+// any of the edits.
+func overlapsEdits(start, end int, edits []Edit) bool {
+	for _, e := range edits {
+		if e.OldPos <= end && e.OldPos+len(e.Removed) >= start {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeTemplatePredictions combines exact and template predictions. When the original
+// change consisted of several hunks (multiHunk), exact matching only repeats a fragment of
+// it, so the template predictions, which cover the whole edit, replace the exact ones.
+// Otherwise template predictions are added where they do not overlap an exact prediction,
+// since the exact one is the smaller edit.
+func mergeTemplatePredictions(exact, fromTemplate []PredictedChange, multiHunk bool) []PredictedChange {
+	if multiHunk {
+		return fromTemplate
+	}
+	merged := append([]PredictedChange{}, exact...)
+	for _, p := range fromTemplate {
+		overlaps := false
+		for _, e := range exact {
+			if predictionsOverlap(p, e) {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
+
+// predictionsOverlap reports whether two predictions touch the same part of the new text.
+// An insertion overlaps a change whose range contains its insertion point.
+func predictionsOverlap(a, b PredictedChange) bool {
+	aStart, aEnd := a.MappedPosition, a.MappedPosition+len(a.TextToRemove)
+	bStart, bEnd := b.MappedPosition, b.MappedPosition+len(b.TextToRemove)
+	if aStart == aEnd || bStart == bEnd {
+		return aStart >= bStart && aStart <= bEnd || bStart >= aStart && bStart <= aEnd
+	}
+	return aStart < bEnd && bStart < aEnd
+}
@@ -0,0 +1,175 @@
+package copre
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "Call with literals",
+			text: `log.Printf("x: %d", a)`,
+			want: []string{"log", ".", "Printf", "(", `"x: %d"`, ",", "a", ")"},
+		},
+		{
+			name: "Escaped quote and numbers",
+			text: `f('\'', 42)`,
+			want: []string{"f", "(", `'\''`, ",", "42", ")"},
+		},
+		{
+			name: "Unterminated string stops at line end",
+			text: "\"abc\nx",
+			want: []string{`"abc`, "x"},
+		},
+		{
+			name: "Unicode identifiers",
+			text: "größe := 1",
+			want: []string{"größe", ":", "=", "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, tok := range tokenize(tt.text) {
+				got = append(got, tok.text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokenize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildEditTemplate(t *testing.T) {
+	dmp := diffmatchpatch.New()
+	tests := []struct {
+		name     string
+		oldText  string
+		newText  string
+		want     string // Rendered pattern, "" for no template
+		wantRepl string // Replacement instantiated with the hole names
+	}{
+		{
+			name:     "Renamed callee keeps its arguments",
+			oldText:  "x := foo(a, 1)",
+			newText:  "x := bar(a, 1)",
+			want:     "foo ( $1 , $2 )",
+			wantRepl: "bar(a, 1)",
+		},
+		{
+			name:     "Inserted argument",
+			oldText:  "foo(a)",
+			newText:  "foo(a, ctx)",
+			want:     "foo ( $1 )",
+			wantRepl: "foo(a, ctx)",
+		},
+		{
+			name:     "Several hunks on one line",
+			oldText:  `log.Printf("x: %d", a)`,
+			newText:  `slog.Info("x", "v", a)`,
+			want:     `log . Printf ( "x: %d" , $1 )`,
+			wantRepl: `slog.Info("x", "v", a)`,
+		},
+		{
+			name:    "No carried-over arguments",
+			oldText: "replace OLD with new",
+			newText: "replace NEW with new",
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs := dmp.DiffCleanupSemantic(dmp.DiffMain(tt.oldText, tt.newText, true))
+			edits := extractEdits(diffs)
+			tmpl := buildEditTemplate(tt.oldText, tt.newText, edits, edits[0], diffs, newConfig(Options{}))
+			if tt.want == "" {
+				if tmpl != nil {
+					t.Fatalf("buildEditTemplate() = %s, want no template", tmpl)
+				}
+				return
+			}
+			if tmpl == nil {
+				t.Fatalf("buildEditTemplate() = nil, want %s", tt.want)
+			}
+			if got := tmpl.String(); got != tt.want {
+				t.Errorf("buildEditTemplate() = %s, want %s", got, tt.want)
+			}
+			if got := tmpl.instantiate(tmpl.holeNames); got != tt.wantRepl {
+				t.Errorf("instantiate() = %q, want %q", got, tt.wantRepl)
+			}
+		})
+	}
+}
+
+func TestEditTemplateMatch(t *testing.T) {
+	// Template foo($1, $1) -> bar($1): the same hole used twice must capture the same text.
+	tmpl := &editTemplate{
+		pattern: []templateToken{
+			{text: "foo", hole: -1}, {text: "(", hole: -1}, {hole: 0}, {text: ",", hole: -1}, {hole: 0}, {text: ")", hole: -1},
+		},
+		replacement: "bar()",
+		holeOffsets: []int{4},
+		holeRefs:    []int{0},
+		holeNames:   []string{"x"},
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		wantOK   bool
+		wantRepl string
+	}{
+		{name: "Simple argument", text: "foo(a, a)", wantOK: true, wantRepl: "bar(a)"},
+		{name: "Sub-expression argument", text: "foo(g(x, y), g(x, y))", wantOK: true, wantRepl: "bar(g(x, y))"},
+		{name: "Inconsistent hole", text: "foo(a, b)", wantOK: false},
+		{name: "Empty hole", text: "foo(, a)", wantOK: false},
+		{name: "Different callee", text: "baz(a, a)", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens := tokenize(tt.text)
+			end, captures, ok := tmpl.match(tt.text, tokens, 0)
+			if ok != tt.wantOK {
+				t.Fatalf("match() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if end != len(tokens) {
+				t.Errorf("match() consumed %d of %d tokens", end, len(tokens))
+			}
+			if got := tmpl.instantiate(captures); got != tt.wantRepl {
+				t.Errorf("instantiate() = %q, want %q", got, tt.wantRepl)
+			}
+		})
+	}
+}
+
+func TestMergeTemplatePredictions(t *testing.T) {
+	exact := []PredictedChange{{MappedPosition: 5, TextToAdd: ", ctx"}}
+	fromTemplate := []PredictedChange{
+		{MappedPosition: 0, TextToRemove: "foo(a)", TextToAdd: "foo(a, ctx)"},  // Contains the insertion point
+		{MappedPosition: 10, TextToRemove: "foo(b)", TextToAdd: "foo(b, ctx)"}, // Only found by the template
+	}
+
+	got := mergeTemplatePredictions(exact, fromTemplate, false)
+	want := []PredictedChange{exact[0], fromTemplate[1]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeTemplatePredictions(single hunk) = %+v, want %+v", got, want)
+	}
+
+	got = mergeTemplatePredictions(exact, fromTemplate, true)
+	if !reflect.DeepEqual(got, fromTemplate) {
+		t.Errorf("mergeTemplatePredictions(multi hunk) = %+v, want %+v", got, fromTemplate)
+	}
+}
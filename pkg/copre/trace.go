@@ -0,0 +1,205 @@
+package copre
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// Trace records how a prediction run arrived at its predictions, for debugging missing
+// or oddly ranked predictions. It is serializable to JSON.
+type Trace struct {
+	Diffs      []TraceDiff      `json:"diffs"`
+	Edits      []Edit           `json:"edits"`                // Every change hunk in the diff
+	Change     *Edit            `json:"change,omitempty"`     // The edit being repeated, nil if there is none
+	Repeated   int              `json:"repeated"`             // How many times the user made the change
+	RenameFrom string           `json:"renameFrom,omitempty"` // Set when the change renames an identifier
+	RenameTo   string           `json:"renameTo,omitempty"`
+	Template   string           `json:"template,omitempty"` // The edit template as "pattern -> replacement", holes written as $1, $2, ...
+	Candidates []TraceCandidate `json:"candidates"`
+}
+
+// TraceDiff is one diff operation.
+type TraceDiff struct {
+	Op   string `json:"op"` // "equal", "delete" or "insert"
+	Text string `json:"text"`
+}
+
+// TraceCandidate is a site considered for a prediction.
+type TraceCandidate struct {
+	Source   string `json:"source"`   // How the site was found: "exact", "insertion", "identifier" or "template"
+	Position int    `json:"position"` // Byte offset in the old text
+	Line     int    `json:"line"`
+	Text     string `json:"text"` // The text at the site the change would replace
+	Score    Score  `json:"score"`
+	Accepted bool   `json:"accepted"`         // Whether the site is among the returned predictions
+	Reason   string `json:"reason,omitempty"` // Why the site was rejected
+}
+
+// Reasons a candidate is rejected.
+const (
+	reasonAlreadyEdited    = "already edited"
+	reasonPartialToken     = "inside a longer identifier"
+	reasonTokensDiffer     = "surrounding tokens differ"
+	reasonTextNotFound     = "text not found at mapped position"
+	reasonOutOfBounds      = "mapped position out of bounds"
+	reasonAlreadyInserted  = "insertion already present"
+	reasonReplacedTemplate = "replaced by template prediction"
+	reasonOverlaps         = "overlaps another prediction"
+	reasonBelowMinScore    = "below minimum score"
+	reasonBeyondMaxResults = "beyond maximum results"
+)
+
+// Explain is PredictWithOptions that also returns a Trace of the run: the diff, the
+// extracted change, every candidate site with its score breakdown and, for the sites
+// that did not become predictions, the reason. A truncated run is traced up to where it
+// stopped.
+func Explain(ctx context.Context, oldText, newText string, opts Options) ([]PredictedChange, *Trace, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	cfg, cancel := startConfig(ctx, opts)
+	defer cancel()
+	cfg.logger.Debug("explaining", "stage", "input", "oldLen", len(oldText), "newLen", len(newText))
+	cfg.trace = &Trace{Diffs: []TraceDiff{}, Edits: []Edit{}, Candidates: []TraceCandidate{}}
+	result := predict(oldText, newText, cfg)
+	for i := range cfg.trace.Candidates {
+		cfg.trace.Candidates[i].Accepted = cfg.trace.Candidates[i].Reason == ""
+	}
+	return result.predictions, cfg.trace, result.err
+}
+
+// The methods below record into the trace of an Explain run. They do nothing on a nil
+// Trace, so the pipeline calls them unconditionally.
+
+// setDiffs records the diff operations.
+func (t *Trace) setDiffs(diffs []diffmatchpatch.Diff) {
+	if t == nil {
+		return
+	}
+	for _, d := range diffs {
+		op := "equal"
+		switch d.Type {
+		case diffmatchpatch.DiffDelete:
+			op = "delete"
+		case diffmatchpatch.DiffInsert:
+			op = "insert"
+		}
+		t.Diffs = append(t.Diffs, TraceDiff{Op: op, Text: d.Text})
+	}
+}
+
+// setChange records the extracted edits and the group of edits being repeated.
+func (t *Trace) setChange(edits, group []Edit) {
+	if t == nil {
+		return
+	}
+	t.Edits = append(t.Edits, edits...)
+	if len(group) > 0 {
+		change := group[0]
+		t.Change, t.Repeated = &change, len(group)
+	}
+}
+
+// setRename records that the change renames from to to.
+func (t *Trace) setRename(from, to string) {
+	if t == nil {
+		return
+	}
+	t.RenameFrom, t.RenameTo = from, to
+}
+
+// setTemplate records the edit template.
+func (t *Trace) setTemplate(tmpl *editTemplate) {
+	if t == nil {
+		return
+	}
+	holes := make([]string, len(tmpl.holeNames))
+	for i := range holes {
+		holes[i] = fmt.Sprintf("$%d", i+1)
+	}
+	t.Template = tmpl.String() + " -> " + tmpl.instantiate(holes)
+}
+
+// addCandidate records a scored candidate site. A site found again by the same source,
+// e.g. when searching from several examples of the edit, keeps its best score.
+func (t *Trace) addCandidate(source string, site Site, score Score) {
+	if t == nil {
+		return
+	}
+	if i := t.find(source, site.Position); i != -1 {
+		if score.Total > t.Candidates[i].Score.Total {
+			t.Candidates[i].Score = score
+		}
+		return
+	}
+	t.Candidates = append(t.Candidates, TraceCandidate{
+		Source:   source,
+		Position: site.Position,
+		Line:     site.Line,
+		Text:     site.Text[site.Position : site.Position+site.Length],
+		Score:    score,
+	})
+}
+
+// rejectCandidate records a candidate site that was rejected before it was scored.
+// score is only called when tracing.
+func (t *Trace) rejectCandidate(source string, site Site, score func() Score, reason string) {
+	if t == nil {
+		return
+	}
+	t.addCandidate(source, site, score())
+	t.reject(site.Position, reason, source)
+}
+
+// addPoints adds a score component to the candidate of source at pos.
+func (t *Trace) addPoints(source string, pos int, name string, points int) {
+	if t == nil || points == 0 {
+		return
+	}
+	if i := t.find(source, pos); i != -1 {
+		c := &t.Candidates[i]
+		c.Score.Total += points
+		c.Score.Breakdown = append(c.Score.Breakdown, ScoreComponent{Name: name, Points: points})
+	}
+}
+
+// reject records why the candidate at pos was dropped: the latest candidate there that
+// was not rejected yet and, if sources are given, was found by one of them.
+func (t *Trace) reject(pos int, reason string, sources ...string) {
+	if t == nil {
+		return
+	}
+	for i := len(t.Candidates) - 1; i >= 0; i-- {
+		c := &t.Candidates[i]
+		if c.Position == pos && c.Reason == "" && (len(sources) == 0 || slices.Contains(sources, c.Source)) {
+			c.Reason = reason
+			return
+		}
+	}
+}
+
+// rejectDropped rejects the candidates of the predictions in before that are not in
+// after, found by one of sources if given.
+func (t *Trace) rejectDropped(before, after []PredictedChange, reason string, sources ...string) {
+	if t == nil {
+		return
+	}
+	for _, p := range before {
+		if !slices.Contains(after, p) {
+			t.reject(p.Position, reason, sources...)
+		}
+	}
+}
+
+// find returns the index of the latest candidate of source at pos, or -1.
+func (t *Trace) find(source string, pos int) int {
+	for i := len(t.Candidates) - 1; i >= 0; i-- {
+		if c := t.Candidates[i]; c.Source == source && c.Position == pos {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,165 @@
+package copre
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// candidateSummary is the part of a TraceCandidate the tests compare.
+type candidateSummary struct {
+	Source   string
+	Position int
+	Score    int
+	Accepted bool
+	Reason   string
+}
+
+func summarizeCandidates(candidates []TraceCandidate) []candidateSummary {
+	summaries := []candidateSummary{}
+	for _, c := range candidates {
+		summaries = append(summaries, candidateSummary{c.Source, c.Position, c.Score.Total, c.Accepted, c.Reason})
+	}
+	return summaries
+}
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		name    string
+		oldText string
+		newText string
+		opts    Options
+		want    []candidateSummary
+	}{
+		{
+			name:    "Rename",
+			oldText: "x := userId\ny := userIdx\nz := userId\n",
+			newText: "x := accountId\ny := userIdx\nz := userId\n",
+			want: []candidateSummary{
+				{"identifier", 5, 10, false, reasonAlreadyEdited},
+				{"identifier", 17, 9, false, reasonPartialToken},
+				{"identifier", 30, 9, true, ""},
+			},
+		},
+		{
+			name:    "Text changed at mapped position",
+			oldText: "a + b\na + b\n",
+			newText: "a - b\na * b\n",
+			want: []candidateSummary{
+				{"exact", 8, 5 + 2 + 2, false, reasonTextNotFound},
+			},
+		},
+		{
+			name:    "Score threshold and result limit",
+			oldText: "v = 1; w = 1; q = 1; r = 1;\n",
+			newText: "v = 2; w = 1; q = 1; r = 1;\n",
+			opts:    Options{MinScore: 10, MaxResults: 1},
+			want: []candidateSummary{
+				{"exact", 11, 10, true, ""},
+				{"exact", 18, 10, false, reasonBeyondMaxResults},
+				{"exact", 25, 9, false, reasonBelowMinScore},
+			},
+		},
+		{
+			name:    "Template overlapping an exact prediction",
+			oldText: "print(1)\nprint(2)\nprint(3)\n",
+			newText: "log(1)\nprint(2)\nlog(3)\n",
+			want: []candidateSummary{
+				{"identifier", 0, 10, false, reasonAlreadyEdited},
+				{"identifier", 9, 5 + 1 + 2, true, ""},
+				{"identifier", 18, 10, false, reasonAlreadyEdited},
+				{"template", 0, 5, false, reasonAlreadyEdited},
+				{"template", 9, 5, false, reasonOverlaps},
+				{"template", 18, 5, false, reasonAlreadyEdited},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			predictions, trace, err := Explain(context.Background(), tt.oldText, tt.newText, tt.opts)
+			if err != nil {
+				t.Fatalf("Explain() error = %v", err)
+			}
+			want, _ := PredictWithOptions(context.Background(), tt.oldText, tt.newText, tt.opts)
+			if !reflect.DeepEqual(predictions, want) {
+				t.Errorf("Explain() predictions = %+v, want %+v", predictions, want)
+			}
+			if got := summarizeCandidates(trace.Candidates); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Explain() candidates = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplainTrace(t *testing.T) {
+	oldText := "a := foo(1)\nb := foo(2)\n"
+	newText := "a := bar(1)\nb := foo(2)\n"
+	_, trace, err := Explain(context.Background(), oldText, newText, Options{})
+	if err != nil {
+		t.Fatalf("Explain() error = %v", err)
+	}
+
+	wantDiffs := []TraceDiff{
+		{Op: "equal", Text: "a := "},
+		{Op: "delete", Text: "foo"},
+		{Op: "insert", Text: "bar"},
+		{Op: "equal", Text: "(1)\nb := foo(2)\n"},
+	}
+	if !reflect.DeepEqual(trace.Diffs, wantDiffs) {
+		t.Errorf("Diffs = %+v, want %+v", trace.Diffs, wantDiffs)
+	}
+	change := Edit{OldPos: 5, NewPos: 5, Removed: "foo", Added: "bar"}
+	if trace.Change == nil || *trace.Change != change || trace.Repeated != 1 {
+		t.Errorf("Change = %+v (repeated %d), want %+v (repeated 1)", trace.Change, trace.Repeated, change)
+	}
+	if trace.RenameFrom != "foo" || trace.RenameTo != "bar" {
+		t.Errorf("Rename = %q -> %q, want foo -> bar", trace.RenameFrom, trace.RenameTo)
+	}
+	if want := "foo ( $1 ) -> bar($1)"; trace.Template != want {
+		t.Errorf("Template = %q, want %q", trace.Template, want)
+	}
+
+	candidate := trace.Candidates[1]
+	wantScore := Score{Total: 10, Breakdown: []ScoreComponent{{"base", 5}, {"prefix", 4}, {"affix", 1}}}
+	if candidate.Text != "foo" || candidate.Line != 2 || !reflect.DeepEqual(candidate.Score, wantScore) {
+		t.Errorf("Candidates[1] = %+v, want foo on line 2 scored %+v", candidate, wantScore)
+	}
+
+	data, err := json.Marshal(trace)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var decoded Trace
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(&decoded, trace) {
+		t.Errorf("JSON round trip = %+v, want %+v", decoded, *trace)
+	}
+}
+
+func TestExplainRepetitionBonus(t *testing.T) {
+	// The edit was made twice, so the remaining candidate gets a repetition component.
+	oldText := "x.a()\nx.a()\nx.a()\n"
+	newText := "x.b()\nx.b()\nx.a()\n"
+	_, trace, _ := Explain(context.Background(), oldText, newText, Options{})
+	last := trace.Candidates[len(trace.Candidates)-1]
+	if !last.Accepted || last.Position != 14 {
+		t.Fatalf("last candidate = %+v, want accepted at 14", last)
+	}
+	breakdown := last.Score.Breakdown
+	if got := breakdown[len(breakdown)-1]; got != (ScoreComponent{"repetition", repeatedEditBonus}) {
+		t.Errorf("last score component = %+v, want repetition", got)
+	}
+}
+
+func TestExplainCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := Explain(ctx, "a", "b", Options{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Explain() error = %v, want context.Canceled", err)
+	}
+}
@@ -2,12 +2,13 @@ package copre
 
 // PredictedChange represents a potential future edit.
 type PredictedChange struct {
-	Position     int    // Byte offset in oldText where the change originates
-	TextToRemove string // The text to be removed
-	// TextToAdd string // Future: Text to add (for insertions/replacements)
-	Line           int // Line number in oldText where the change originates (1-based)
-	Score          int // Confidence score for this prediction
-	MappedPosition int // Corresponding byte offset in newText where the change should be applied
+	Position       int    `json:"position"`        // Byte offset in oldText where the change originates
+	TextToRemove   string `json:"textToRemove"`    // The text to be removed
+	TextToAdd      string `json:"textToAdd"`       // The text to be inserted at MappedPosition (for insertions and replacements)
+	Line           int    `json:"line"`            // Line number in oldText where the change originates (1-based)
+	Score          int    `json:"score"`           // Confidence score for this prediction
+	MappedPosition int    `json:"mappedPosition"`  // Corresponding byte offset in newText where the change should be applied
+	Range          *Range `json:"range,omitempty"` // The text to remove in newText, if requested with Options.RangeUnit
 }
 
 // Anchor represents a potential location for a predicted change in the old text.
@@ -16,3 +17,12 @@ type Anchor struct {
 	Score    int
 	Line     int // Line number in oldText
 }
+
+// Edit is a single contiguous change (hunk) between two versions of a text.
+// An Edit with both Removed and Added set is a replacement.
+type Edit struct {
+	OldPos  int    `json:"oldPos"`  // Byte offset in the old text where the change starts
+	NewPos  int    `json:"newPos"`  // Byte offset in the new text where the change starts
+	Removed string `json:"removed"` // Text removed from the old text (empty for insertions)
+	Added   string `json:"added"`   // Text inserted into the new text (empty for deletions)
+}
@@ -1,7 +1,7 @@
 package copre
 
 import (
-	"log"
+	"fmt"
 	"sort"
 	"strings"
 )
@@ -9,11 +9,13 @@ import (
 // ANSI color codes
 const (
 	red   = "\033[31m"
+	green = "\033[32m"
 	reset = "\033[0m"
 )
 
 // VisualizePredictions highlights predicted changes within the text.
-// It sorts predictions by their mapped position in the new text and applies highlighting.
+// It sorts predictions by their mapped position in the new text and applies highlighting:
+// text to remove is shown in red and text to add is shown in green at its insertion point.
 func VisualizePredictions(text string, predictions []PredictedChange) string {
 	// Sort predictions by MappedPosition *ascending* so we process from start to end.
 	sort.Slice(predictions, func(i, j int) bool {
@@ -24,20 +26,20 @@ func VisualizePredictions(text string, predictions []PredictedChange) string {
 	lastPos := 0
 
 	for _, p := range predictions {
+		if p.TextToRemove == "" && p.TextToAdd == "" {
+			continue // Nothing to show
+		}
 		// Ensure prediction indices are valid for the *current* text length being processed
 		if p.MappedPosition < lastPos {
-			log.Printf("WARN: Skipping overlapping or out-of-order prediction: %+v", p)
-			continue
+			continue // Overlaps the previous prediction
 		}
 		// Check if the end position of the removal exceeds the text length
 		endPos := p.MappedPosition + len(p.TextToRemove)
 		if endPos > len(text) {
-			log.Printf("WARN: Skipping prediction out of bounds (end %d > len %d): %+v", endPos, len(text), p)
 			continue
 		}
 		// Check if MappedPosition itself is out of bounds
 		if p.MappedPosition > len(text) {
-			log.Printf("WARN: Skipping prediction out of bounds (start %d > len %d): %+v", p.MappedPosition, len(text), p)
 			continue
 		}
 
@@ -47,9 +49,18 @@ func VisualizePredictions(text string, predictions []PredictedChange) string {
 		}
 
 		// Append the highlighted text to remove
-		builder.WriteString(red)
-		builder.WriteString(text[p.MappedPosition:endPos])
-		builder.WriteString(reset)
+		if endPos > p.MappedPosition {
+			builder.WriteString(red)
+			builder.WriteString(text[p.MappedPosition:endPos])
+			builder.WriteString(reset)
+		}
+
+		// Append the highlighted text to add
+		if p.TextToAdd != "" {
+			builder.WriteString(green)
+			builder.WriteString(p.TextToAdd)
+			builder.WriteString(reset)
+		}
 
 		// Update the last position handled to be *after* the removed text
 		lastPos = endPos
@@ -62,3 +73,141 @@ func VisualizePredictions(text string, predictions []PredictedChange) string {
 
 	return builder.String()
 }
+
+// PatchOptions configures RenderPatch.
+type PatchOptions struct {
+	Context  int // Lines of context around each change: 3 if zero, none if negative
+	MinScore int // If positive, predictions scoring below it are left out
+}
+
+// defaultPatchContext is the number of context lines of diff -u and git diff.
+const defaultPatchContext = 3
+
+// patchHunk is a hunk of RenderPatch: the lines first to last (0-based, inclusive) of the
+// text and the predictions changing them.
+type patchHunk struct {
+	first, last int
+	predictions []PredictedChange
+}
+
+// RenderPatch renders predictions as a unified diff of text, the newText they were
+// predicted for, that carries them out. The file is called path in the headers, with
+// git's "a/" and "b/" prefixes, so the patch can be applied with git apply or patch -p1.
+// Each prediction gets its own hunk, unless no unchanged line separates it from the
+// previous one. Hunks do not overlap: where the context of two hunks would, the lines
+// between them are split between the trailing context of the first and the leading
+// context of the second. A patch without context (a negative Context) needs
+// git apply --unidiff-zero.
+// Predictions that cannot be applied together are left out as ApplyPredictions leaves
+// them out. It returns "" if no prediction remains.
+func RenderPatch(path, text string, predictions []PredictedChange, opts PatchOptions) string {
+	var kept []PredictedChange
+	for _, p := range predictions {
+		if opts.MinScore <= 0 || p.Score >= opts.MinScore {
+			kept = append(kept, p)
+		}
+	}
+	applied := ApplyPredictions(text, kept).Applied
+	if len(applied) == 0 {
+		return ""
+	}
+	context := opts.Context
+	if context == 0 {
+		context = defaultPatchContext
+	}
+	context = max(context, 0)
+
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	lineStarts := make([]int, len(lines)+1)
+	for i, line := range lines {
+		lineStarts[i+1] = lineStarts[i] + len(line)
+	}
+	lineOf := func(offset int) int {
+		line := sort.Search(len(lines), func(i int) bool { return lineStarts[i+1] > offset })
+		if line == len(lines) && line > 0 && !strings.HasSuffix(text, "\n") {
+			return line - 1 // The end of a last line without a newline
+		}
+		return line
+	}
+
+	// Group the predictions into hunks by the lines they change
+	var hunks []patchHunk
+	for _, p := range applied {
+		first, last := lineOf(p.MappedPosition), lineOf(p.MappedPosition)
+		if p.TextToRemove != "" {
+			last = lineOf(p.MappedPosition + len(p.TextToRemove) - 1)
+		}
+		if n := len(hunks); n > 0 && first <= hunks[n-1].last+1 {
+			hunks[n-1].last = max(hunks[n-1].last, last)
+			hunks[n-1].predictions = append(hunks[n-1].predictions, p)
+			continue
+		}
+		hunks = append(hunks, patchHunk{first: first, last: last, predictions: []PredictedChange{p}})
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", path, path)
+	delta := 0 // How many lines the hunks so far added
+	for i, h := range hunks {
+		start, end := max(h.first-context, 0), min(h.last+1+context, len(lines))
+		if i > 0 {
+			gap := h.first - hunks[i-1].last - 1
+			start = h.first - min(context, gap/2)
+		}
+		if i+1 < len(hunks) {
+			// The trailing context gets the larger half, since git apply takes a hunk
+			// without trailing context to be at the end of the file
+			gap := hunks[i+1].first - h.last - 1
+			end = h.last + 1 + min(context, gap-gap/2)
+		}
+		// The changed lines, and what they become
+		changeStart, changeEnd := lineStarts[min(h.first, len(lines))], lineStarts[min(h.last+1, len(lines))]
+		var changed strings.Builder
+		last := changeStart
+		for _, p := range h.predictions {
+			changed.WriteString(text[last:p.MappedPosition])
+			changed.WriteString(p.TextToAdd)
+			last = p.MappedPosition + len(p.TextToRemove)
+		}
+		changed.WriteString(text[last:changeEnd])
+		oldLines := lines[min(h.first, len(lines)):min(h.last+1, len(lines))]
+		newLines := strings.SplitAfter(changed.String(), "\n")
+		if newLines[len(newLines)-1] == "" {
+			newLines = newLines[:len(newLines)-1]
+		}
+
+		oldCount := end - start
+		newCount := oldCount - len(oldLines) + len(newLines)
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(start, oldCount), hunkRange(start+delta, newCount))
+		writePatchLines(&b, ' ', lines[start:min(h.first, len(lines))])
+		writePatchLines(&b, '-', oldLines)
+		writePatchLines(&b, '+', newLines)
+		writePatchLines(&b, ' ', lines[min(h.last+1, len(lines)):end])
+		delta += newCount - oldCount
+	}
+	return b.String()
+}
+
+// hunkRange formats the range of a hunk header, whose lines start at the 0-based line
+// start: "start,count" with a 1-based start, or, for an empty range, the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// writePatchLines writes lines to a hunk, each prefixed with op, marking a last line
+// without a newline as diff does.
+func writePatchLines(b *strings.Builder, op byte, lines []string) {
+	for _, line := range lines {
+		b.WriteByte(op)
+		b.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			b.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
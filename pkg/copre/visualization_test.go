@@ -22,6 +22,7 @@ func TestVisualizePredictions(t *testing.T) {
 
 	// ANSI codes defined in visualization.go
 	red := "\033[31m"
+	green := "\033[32m"
 	reset := "\033[0m"
 
 	tests := []struct {
@@ -113,6 +114,18 @@ func TestVisualizePredictions(t *testing.T) {
 			predictions: []PredictedChange{makePred("", 6)},
 			want:        "hello world", // Should not change the text
 		},
+		{
+			name:        "Insertion prediction",
+			text:        "foo(a)",
+			predictions: []PredictedChange{{TextToAdd: ", ctx", MappedPosition: 5}},
+			want:        fmt.Sprintf("foo(a%s, ctx%s)", green, reset),
+		},
+		{
+			name:        "Replacement prediction",
+			text:        "a := 1",
+			predictions: []PredictedChange{{TextToRemove: "a", TextToAdd: "b", MappedPosition: 0}},
+			want:        fmt.Sprintf("%sa%s%sb%s := 1", red, reset, green, reset),
+		},
 		{
 			name:        "Multi-line text",
 			text:        "line1\nline2 del\nline3",
@@ -141,3 +154,89 @@ func TestVisualizePredictions(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderPatch(t *testing.T) {
+	const text = "a := userId\nb\nc\nd\ne\nf := userId\ng\nh\ni\nj\nk\nl := userId\n"
+	replace := func(line, pos, score int) PredictedChange {
+		return PredictedChange{TextToRemove: "userId", TextToAdd: "accountId", Line: line, Score: score, MappedPosition: pos}
+	}
+	predictions := []PredictedChange{replace(12, 47, 9), replace(6, 25, 12)}
+
+	tests := []struct {
+		name        string
+		text        string
+		predictions []PredictedChange
+		opts        PatchOptions
+		want        string
+	}{
+		{
+			name:        "default context, cut short between hunks",
+			text:        text,
+			predictions: predictions,
+			want: `--- a/f.go
++++ b/f.go
+@@ -3,7 +3,7 @@
+ c
+ d
+ e
+-f := userId
++f := accountId
+ g
+ h
+ i
+@@ -10,3 +10,3 @@
+ j
+ k
+-l := userId
++l := accountId
+`,
+		},
+		{
+			name:        "no context and a score threshold",
+			text:        text,
+			predictions: predictions,
+			opts:        PatchOptions{Context: -1, MinScore: 10},
+			want: `--- a/f.go
++++ b/f.go
+@@ -6,1 +6,1 @@
+-f := userId
++f := accountId
+`,
+		},
+		{
+			name: "predictions on the same or adjacent lines share a hunk",
+			text: "x.old.old\ny\nz",
+			predictions: []PredictedChange{
+				{TextToRemove: ".old", MappedPosition: 1},
+				{TextToRemove: ".old", MappedPosition: 5},
+				{TextToAdd: "!", MappedPosition: 13},
+				{TextToRemove: "y\n", MappedPosition: 10},
+			},
+			opts: PatchOptions{Context: 1},
+			want: `--- a/f.go
++++ b/f.go
+@@ -1,3 +1,2 @@
+-x.old.old
+-y
+-z
+\ No newline at end of file
++x
++z!
+\ No newline at end of file
+`,
+		},
+		{
+			name:        "nothing to apply",
+			text:        text,
+			predictions: []PredictedChange{{TextToRemove: "missing", MappedPosition: 0}},
+			want:        "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderPatch("f.go", tt.text, tt.predictions, tt.opts); got != tt.want {
+				t.Errorf("RenderPatch() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}